@@ -6,6 +6,8 @@ package apiserver
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
@@ -17,6 +19,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -30,41 +34,78 @@ import (
 	newrelic "github.com/newrelic/go-agent"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/cors"
-	"golang.org/x/text/language"
 
 	"github.com/fiorix/freegeoip"
 )
 
 type apiHandler struct {
 	db    *freegeoip.DB
+	dbs   *freegeoip.Manager
 	conf  *Config
 	cors  *cors.Cors
 	nrapp newrelic.Application
+	rl    *httprl.RateLimiter
+
+	fallback []string // Fallback languages of names, see Config.LangFallback.
 }
 
 // NewHandler creates an http handler for the freegeoip server that
-// can be embedded in other servers.
+// can be embedded in other servers. See NewHandlers for the admin
+// endpoints.
 func NewHandler(c *Config) (http.Handler, error) {
-	db, err := openDB(c)
+	h, _, err := NewHandlers(c)
+	return h, err
+}
+
+// NewHandlers creates the http handler for the freegeoip server, and
+// the handler for its admin endpoints under /admin/, e.g. for rolling
+// back databases.
+//
+// The admin endpoints have no authentication. They must only be served
+// on an internal address, never alongside the public handler.
+func NewHandlers(c *Config) (http.Handler, http.Handler, error) {
+	dbs, err := openDBs(c)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
+		return nil, nil, fmt.Errorf("failed to open database: %v", err)
 	}
+	db := dbs.DB(primaryDB)
 	cf := cors.New(cors.Options{
 		AllowedOrigins:   strings.Split(c.CORSOrigin, ","),
-		AllowedMethods:   []string{"GET"},
+		AllowedMethods:   []string{"GET", "POST"},
 		AllowCredentials: true,
 	})
-	f := &apiHandler{db: db, conf: c, cors: cf}
+	f := &apiHandler{db: db, dbs: dbs, conf: c, cors: cf}
+	if c.ReservedStatus != 0 && (c.ReservedStatus < 400 || c.ReservedStatus > 499) {
+		return nil, nil, fmt.Errorf("invalid status for reserved addresses: %d, want 4xx", c.ReservedStatus)
+	}
+	if f.fallback, err = parseLangFallback(c.LangFallback); err != nil {
+		return nil, nil, err
+	}
 	mc := httpmux.DefaultConfig
 	if err := f.config(&mc); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	mux := httpmux.NewHandler(&mc)
 	mux.GET("/csv/*host", f.register("csv", csvWriter))
 	mux.GET("/xml/*host", f.register("xml", xmlWriter))
 	mux.GET("/json/*host", f.register("json", jsonWriter))
-	go watchEvents(db)
-	return mux, nil
+	mux.GET("/ndjson/*host", f.register("ndjson", ndjsonWriter))
+	mux.GET("/v2/csv/*host", f.instrument("v2_csv", f.v2lookup(v2CSVWriter)))
+	mux.GET("/v2/xml/*host", f.instrument("v2_xml", f.v2lookup(v2XMLWriter)))
+	mux.GET("/v2/json/*host", f.instrument("v2_json", f.v2lookup(v2JSONWriter)))
+	mux.GET("/api/status", f.status)
+	if c.BatchLimit > 0 {
+		mux.POST("/batch", f.cors.Handler(prometheus.InstrumentHandlerFunc("batch", f.batch)).ServeHTTP)
+	}
+	for _, name := range dbs.Names() {
+		go watchEvents(name, dbs.DB(name).Subscribe())
+	}
+	if c.LookupCache > 0 {
+		lookupCacheMetrics.set(dbs)
+	}
+	admin := http.NewServeMux()
+	admin.HandleFunc("/admin/rollback", f.rollback)
+	return mux, admin, nil
 }
 
 func (f *apiHandler) config(mc *httpmux.Config) error {
@@ -86,6 +127,7 @@ func (f *apiHandler) config(mc *httpmux.Config) error {
 			return fmt.Errorf("failed to create rate limiter: %v", err)
 		}
 		mc.Use(rl.Handle)
+		f.rl = rl
 	}
 	if f.conf.NewrelicName != "" && f.conf.NewrelicKey != "" {
 		config := newrelic.NewConfig(f.conf.NewrelicName, f.conf.NewrelicKey)
@@ -155,11 +197,17 @@ func clientMetricsMiddleware(db *freegeoip.DB) httpmux.MiddlewareFunc {
 type writerFunc func(w http.ResponseWriter, r *http.Request, d *responseRecord)
 
 func (f *apiHandler) register(name string, writer writerFunc) http.HandlerFunc {
+	return f.instrument(name, f.iplookup(writer))
+}
+
+// instrument returns the handler with metrics and CORS, for serving
+// lookups at the endpoint of the given name.
+func (f *apiHandler) instrument(name string, handler http.HandlerFunc) http.HandlerFunc {
 	var h http.Handler
 	if f.nrapp == nil {
-		h = prometheus.InstrumentHandler(name, f.iplookup(writer))
+		h = prometheus.InstrumentHandler(name, handler)
 	} else {
-		h = prometheus.InstrumentHandler(newrelic.WrapHandle(f.nrapp, name, f.iplookup(writer)))
+		h = prometheus.InstrumentHandler(newrelic.WrapHandle(f.nrapp, name, handler))
 	}
 
 	return f.cors.Handler(h).ServeHTTP
@@ -167,39 +215,131 @@ func (f *apiHandler) register(name string, writer writerFunc) http.HandlerFunc {
 
 func (f *apiHandler) iplookup(writer writerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		host := httpmux.Params(r).ByName("host")
-		if len(host) > 0 && host[0] == '/' {
-			host = host[1:]
+		fields, err := parseFields(r.FormValue("fields"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		if host == "" {
-			host, _, _ = net.SplitHostPort(r.RemoteAddr)
-			if host == "" {
-				host = r.RemoteAddr
-			}
+		names, err := f.selectNames(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		ips, err := net.LookupIP(host)
-		if err != nil || len(ips) == 0 {
+		ip := hostIP(r)
+		if ip == nil {
 			http.NotFound(w, r)
 			return
 		}
-		ip, q := ips[rand.Intn(len(ips))], &geoipQuery{}
-		err = f.db.Lookup(ip, &q.DefaultQuery)
+		q, err := f.lookup(ip, needsCity(fields))
 		if err != nil {
 			http.Error(w, "Try again later.", http.StatusServiceUnavailable)
 			return
 		}
 		w.Header().Set("X-Database-Date", f.db.Date().Format(http.TimeFormat))
-		resp := q.Record(ip, r.Header.Get("Accept-Language"))
+		if msg := f.rejectReserved(ip, !q.empty()); msg != "" {
+			http.Error(w, msg, f.conf.ReservedStatus)
+			return
+		}
+		resp := q.Record(ip, names)
+		resp.fields = fields
 		writer(w, r, resp)
 	}
 }
 
+// hostIP returns the IP address of the host in the path of the
+// request, or of the client when there's none. Host names are
+// resolved, and one of their addresses is picked at random. It returns
+// nil if the host doesn't resolve.
+func hostIP(r *http.Request) net.IP {
+	host := httpmux.Params(r).ByName("host")
+	if len(host) > 0 && host[0] == '/' {
+		host = host[1:]
+	}
+	if host == "" {
+		host, _, _ = net.SplitHostPort(r.RemoteAddr)
+		if host == "" {
+			host = r.RemoteAddr
+		}
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return nil
+	}
+	return ips[rand.Intn(len(ips))]
+}
+
+// rejectReserved returns the error of lookups of reserved addresses
+// that were not found in the databases, if they are rejected, or an
+// empty string.
+func (f *apiHandler) rejectReserved(ip net.IP, found bool) string {
+	if f.conf.ReservedStatus == 0 || found {
+		return ""
+	}
+	sp := freegeoip.LookupSpecialPurpose(ip)
+	if sp == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s is a reserved address (%s)", ip, sp.Scope)
+}
+
 func csvWriter(w http.ResponseWriter, r *http.Request, d *responseRecord) {
+	header, err := boolParam(r, "header")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	w.Header().Set("Content-Type", "text/csv")
+	if header {
+		cw := csv.NewWriter(w)
+		cw.UseCRLF = true
+		cw.Write(d.csvHeader())
+		cw.Flush()
+	}
 	io.WriteString(w, d.String())
 }
 
 func xmlWriter(w http.ResponseWriter, r *http.Request, d *responseRecord) {
+	writeXML(w, d.selected())
+}
+
+func jsonWriter(w http.ResponseWriter, r *http.Request, d *responseRecord) {
+	writeJSON(w, r, d.selected())
+}
+
+func ndjsonWriter(w http.ResponseWriter, r *http.Request, d *responseRecord) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	json.NewEncoder(w).Encode(d.selected())
+	flush(w)
+}
+
+// ndjsonContentType is the content type of newline delimited JSON, of
+// one record per line.
+const ndjsonContentType = "application/x-ndjson"
+
+// flush sends the response written so far to the client, if the
+// response writer supports it.
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// boolParam returns the value of the boolean parameter of the request,
+// e.g. header=true, or false if not set.
+func boolParam(r *http.Request, name string) (bool, error) {
+	s := r.FormValue(name)
+	if s == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter: %q", name, s)
+	}
+	return v, nil
+}
+
+// writeXML writes the response d as indented XML.
+func writeXML(w http.ResponseWriter, d interface{}) {
 	w.Header().Set("Content-Type", "application/xml")
 	x := xml.NewEncoder(w)
 	x.Indent("", "\t")
@@ -207,7 +347,9 @@ func xmlWriter(w http.ResponseWriter, r *http.Request, d *responseRecord) {
 	w.Write([]byte{'\n'})
 }
 
-func jsonWriter(w http.ResponseWriter, r *http.Request, d *responseRecord) {
+// writeJSON writes the response d as JSON, or JSONP if the request has
+// the callback parameter.
+func writeJSON(w http.ResponseWriter, r *http.Request, d interface{}) {
 	if cb := r.FormValue("callback"); cb != "" {
 		w.Header().Set("Content-Type", "application/javascript")
 		io.WriteString(w, cb)
@@ -227,48 +369,42 @@ type geoipQuery struct {
 	freegeoip.DefaultQuery
 }
 
-func (q *geoipQuery) Record(ip net.IP, lang string) *responseRecord {
-	lang = parseAcceptLanguage(lang, q.Country.Names)
-
+// Record returns the response of the query, with the names selected
+// by n.
+func (q *geoipQuery) Record(ip net.IP, n *nameSelector) *responseRecord {
 	r := &responseRecord{
 		IP:          ip.String(),
 		CountryCode: q.Country.ISOCode,
-		CountryName: q.Country.Names[lang],
-		City:        q.City.Names[lang],
+		CountryName: n.name(q.Country.Names),
+		City:        n.name(q.City.Names),
 		ZipCode:     q.Postal.Code,
 		TimeZone:    q.Location.TimeZone,
 		Latitude:    roundFloat(q.Location.Latitude, .5, 4),
 		Longitude:   roundFloat(q.Location.Longitude, .5, 4),
 		MetroCode:   q.Location.MetroCode,
+
+		ASN:               q.AutonomousSystemNumber,
+		ASOrganization:    q.AutonomousSystemOrganization,
+		IsAnonymous:       q.IsAnonymous,
+		IsAnonymousVPN:    q.IsAnonymousVPN,
+		IsHostingProvider: q.IsHostingProvider,
+		IsPublicProxy:     q.IsPublicProxy,
+		IsTorExitNode:     q.IsTorExitNode,
+		ConnectionType:    q.ConnectionType,
 	}
 	if len(q.Region) > 0 {
 		r.RegionCode = q.Region[0].ISOCode
-		r.RegionName = q.Region[0].Names[lang]
+		r.RegionName = n.name(q.Region[0].Names)
+	}
+	if sp := freegeoip.LookupSpecialPurpose(ip); sp != nil {
+		r.Reserved, r.Scope = true, sp.Scope
 	}
 	return r
 }
 
-func parseAcceptLanguage(header string, dbLangs map[string]string) string {
-	// supported languages -- i.e. languages available in the DB
-	matchLangs := []language.Tag{
-		language.English,
-	}
-
-	// parse available DB languages and add to supported
-	for name := range dbLangs {
-		matchLangs = append(matchLangs, language.Raw.Make(name))
-	}
-
-	var matcher = language.NewMatcher(matchLangs)
-
-	// parse header
-	t, _, _ := language.ParseAcceptLanguage(header)
-	// match most acceptable language
-	tag, _, _ := matcher.Match(t...)
-	// extract base language
-	base, _ := tag.Base()
-
-	return base.String()
+// empty returns true if no database has a record of the IP address.
+func (q *geoipQuery) empty() bool {
+	return reflect.DeepEqual(q.DefaultQuery, freegeoip.DefaultQuery{})
 }
 
 func roundFloat(val float64, roundOn float64, places int) (newVal float64) {
@@ -297,13 +433,83 @@ type responseRecord struct {
 	Latitude    float64  `json:"latitude"`
 	Longitude   float64  `json:"longitude"`
 	MetroCode   uint     `json:"metro_code"`
+
+	// Optional fields from additional databases. These are omitted
+	// when empty, and are not part of the CSV response.
+	ASN               uint   `json:"asn,omitempty" xml:",omitempty"`
+	ASOrganization    string `json:"as_organization,omitempty" xml:",omitempty"`
+	IsAnonymous       bool   `json:"is_anonymous,omitempty" xml:",omitempty"`
+	IsAnonymousVPN    bool   `json:"is_anonymous_vpn,omitempty" xml:",omitempty"`
+	IsHostingProvider bool   `json:"is_hosting_provider,omitempty" xml:",omitempty"`
+	IsPublicProxy     bool   `json:"is_public_proxy,omitempty" xml:",omitempty"`
+	IsTorExitNode     bool   `json:"is_tor_exit_node,omitempty" xml:",omitempty"`
+	ConnectionType    string `json:"connection_type,omitempty" xml:",omitempty"`
+
+	// Set for private, loopback and other special-purpose addresses,
+	// with the scope of the address, e.g. private or documentation.
+	Reserved bool   `json:"reserved,omitempty" xml:",omitempty"`
+	Scope    string `json:"scope,omitempty" xml:",omitempty"`
+
+	// Fields selected with the fields parameter, or nil for all.
+	fields []*responseField
+}
+
+// selected returns the record with the selected fields only.
+func (rr *responseRecord) selected() interface{} {
+	if rr.fields == nil {
+		return rr
+	}
+	return &projection{rr, rr.fields}
 }
 
 func (rr *responseRecord) String() string {
 	b := &bytes.Buffer{}
 	w := csv.NewWriter(b)
 	w.UseCRLF = true
-	w.Write([]string{
+	w.Write(rr.csvFields())
+	w.Flush()
+	return b.String()
+}
+
+// csvHeader has the names of the fields of CSV responses.
+var csvHeader = []string{
+	"ip",
+	"country_code",
+	"country_name",
+	"region_code",
+	"region_name",
+	"city",
+	"zip_code",
+	"time_zone",
+	"latitude",
+	"longitude",
+	"metro_code",
+}
+
+// csvHeader returns the header row of CSV responses, with the names of
+// the selected fields only, if any.
+func (rr *responseRecord) csvHeader() []string {
+	if rr.fields == nil {
+		return csvHeader
+	}
+	names := make([]string, len(rr.fields))
+	for i, f := range rr.fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// csvFields returns the fields of the record in CSV responses, or the
+// selected fields only, in order.
+func (rr *responseRecord) csvFields() []string {
+	if rr.fields != nil {
+		fields := make([]string, len(rr.fields))
+		for i, f := range rr.fields {
+			fields[i] = f.csv(rr)
+		}
+		return fields
+	}
+	return []string{
 		rr.IP,
 		rr.CountryCode,
 		rr.CountryName,
@@ -315,15 +521,53 @@ func (rr *responseRecord) String() string {
 		strconv.FormatFloat(rr.Latitude, 'f', 4, 64),
 		strconv.FormatFloat(rr.Longitude, 'f', 4, 64),
 		strconv.Itoa(int(rr.MetroCode)),
-	})
-	w.Flush()
-	return b.String()
+	}
+}
+
+// primaryDB is the name of the database set by Config.DB.
+const primaryDB = "city"
+
+// openDBs opens the main IP database and any additional databases
+// configured in Config.Databases.
+func openDBs(c *Config) (*freegeoip.Manager, error) {
+	dbs := freegeoip.NewManager()
+	db, err := openDB(c)
+	if err != nil {
+		return nil, err
+	}
+	if err = dbs.Add(primaryDB, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, spec := range strings.Split(c.Databases, ",") {
+		if spec == "" {
+			continue
+		}
+		kv := strings.SplitN(spec, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			dbs.Close()
+			return nil, fmt.Errorf("invalid database %q: want name=file-or-url", spec)
+		}
+		name, dsn := kv[0], kv[1]
+		src, err := newSource(c, dsn)
+		if err == nil && src == nil {
+			_, err = dbs.Open(name, dsn, dbOptions(c)...)
+		} else if err == nil {
+			_, err = dbs.OpenSource(name, src, c.UpdateInterval, c.RetryInterval, dbOptions(c)...)
+		}
+		if err != nil {
+			dbs.Close()
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return dbs, nil
 }
 
 // openDB opens and returns the IP database file or URL.
 func openDB(c *Config) (*freegeoip.DB, error) {
-	// This is a paid product. Get the updates URL.
-	if len(c.UserID) > 0 && len(c.LicenseKey) > 0 {
+	switch {
+	case len(c.UserID) > 0 && len(c.LicenseKey) > 0:
+		// Legacy updates protocol. Get the updates URL.
 		var err error
 		c.DB, err = freegeoip.MaxMindUpdateURL(
 			c.UpdatesHost,
@@ -335,29 +579,215 @@ func openDB(c *Config) (*freegeoip.DB, error) {
 			return nil, err
 		}
 		log.Println("Using updates URL:", c.DB)
+	case len(c.LicenseKey) > 0 && c.DB == freegeoip.MaxMindDB:
+		// Only replace the default database, not one set with -db.
+		c.DB = freegeoip.MaxMindDownloadURL(
+			c.DownloadHost,
+			c.ProductID,
+			c.LicenseKey,
+		)
+		log.Printf("Using MaxMind downloads for %s from %s", c.ProductID, c.DownloadHost)
 	}
 
-	u, err := url.Parse(c.DB)
+	opts, err := validateOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(dbOptions(c), opts...)
+	if c.Overlay != "" {
+		opts = append(opts, freegeoip.Overlay(c.Overlay))
+	}
+	src, err := newSource(c, c.DB)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return freegeoip.Open(c.DB, opts...)
+	}
+	vopts, err := verifyOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, vopts...)
+	return freegeoip.OpenSource(src, c.UpdateInterval, c.RetryInterval, opts...)
+}
+
+// newSource returns the source of database files for dsn, which is
+// either a URL, an S3 object as in s3://bucket/key, or a directory.
+// It returns nil if dsn is a local database file.
+func newSource(c *Config, dsn string) (freegeoip.Source, error) {
+	u, err := url.Parse(dsn)
 	if err != nil || len(u.Scheme) == 0 {
-		return freegeoip.Open(c.DB)
+		if stat, err := os.Stat(dsn); err == nil && stat.IsDir() {
+			return &freegeoip.DirSource{Dir: dsn}, nil
+		}
+		return nil, nil
+	}
+	if u.Scheme != "s3" {
+		return &freegeoip.HTTPSource{URL: dsn}, nil
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid s3 object %q: want s3://bucket/key", dsn)
+	}
+	return &freegeoip.S3Source{
+		Endpoint:        c.S3Endpoint,
+		Region:          c.S3Region,
+		Bucket:          u.Host,
+		Key:             key,
+		AccessKeyID:     c.S3AccessKeyID,
+		SecretAccessKey: c.S3SecretAccessKey,
+	}, nil
+}
+
+// validateOptions returns the options for validating new versions of
+// the main database set in the config before loading them.
+func validateOptions(c *Config) ([]freegeoip.Option, error) {
+	if c.DBType == "" && c.DBCanaries == "" {
+		return nil, nil
 	}
-	return freegeoip.OpenURL(c.DB, c.UpdateInterval, c.RetryInterval)
+	v := freegeoip.Validation{
+		DatabaseType: c.DBType,
+		Canaries:     make(map[string]string),
+	}
+	for _, canary := range strings.Split(c.DBCanaries, ",") {
+		canary = strings.TrimSpace(canary)
+		if canary == "" {
+			continue
+		}
+		kv := strings.SplitN(canary, "=", 2)
+		if len(kv) != 2 || net.ParseIP(kv[0]) == nil || kv[1] == "" {
+			return nil, fmt.Errorf("invalid database canary: %q", canary)
+		}
+		v.Canaries[kv[0]] = kv[1]
+	}
+	return []freegeoip.Option{freegeoip.Validate(v)}, nil
+}
+
+// verifyOptions returns the options for verifying downloads of the
+// main database set in the config.
+func verifyOptions(c *Config) ([]freegeoip.Option, error) {
+	var opts []freegeoip.Option
+	if c.DBSHA256 != "" {
+		opts = append(opts, freegeoip.SHA256(c.DBSHA256))
+	}
+	if c.DBSHA256URL != "" {
+		opts = append(opts, freegeoip.SHA256URL(c.DBSHA256URL))
+	}
+	if c.DBSignatureURL != "" {
+		key, err := base64.StdEncoding.DecodeString(c.DBPublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key: %q", c.DBPublicKey)
+		}
+		opts = append(opts, freegeoip.Signature(c.DBSignatureURL, key))
+	}
+	return opts, nil
+}
+
+// dbOptions returns the database options set in the config.
+func dbOptions(c *Config) []freegeoip.Option {
+	var opts []freegeoip.Option
+	if c.MemoryMap {
+		opts = append(opts, freegeoip.MemoryMap())
+	}
+	if c.LookupCache > 0 {
+		opts = append(opts, freegeoip.LookupCache(c.LookupCache))
+	}
+	if c.DBVersions > 1 {
+		opts = append(opts, freegeoip.KeepVersions(c.DBVersions))
+	}
+	if c.CacheDir != "" {
+		opts = append(opts, freegeoip.Cache(freegeoip.CacheOptions{Dir: c.CacheDir}))
+	}
+	return opts
+}
+
+// statusResponse is the response of the status endpoint.
+type statusResponse struct {
+	Databases map[string]*dbStatus `json:"databases"`
+}
+
+// dbStatus is the metadata of a database, or the reason it's not
+// available.
+type dbStatus struct {
+	*freegeoip.Metadata
+	Error string `json:"error,omitempty"`
+}
+
+// status handles requests for the metadata of the databases in use,
+// e.g. GET /api/status, so operators can see what each server is serving.
+func (f *apiHandler) status(w http.ResponseWriter, r *http.Request) {
+	resp := &statusResponse{Databases: make(map[string]*dbStatus)}
+	for _, name := range f.dbs.Names() {
+		md, err := f.dbs.DB(name).Metadata()
+		if err != nil {
+			resp.Databases[name] = &dbStatus{Error: err.Error()}
+			continue
+		}
+		resp.Databases[name] = &dbStatus{Metadata: md}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// rollback handles requests to roll back a database to its previous
+// version, e.g. POST /admin/rollback?db=city. The database defaults
+// to the main database.
+func (f *apiHandler) rollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.FormValue("db")
+	if name == "" {
+		name = primaryDB
+	}
+	db := f.dbs.DB(name)
+	if db == nil {
+		http.Error(w, "unknown database: "+name, http.StatusNotFound)
+		return
+	}
+	switch err := db.Rollback(); err {
+	case nil:
+	case freegeoip.ErrNoBackup, freegeoip.ErrNoSource:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("database %s rolled back by %s", name, r.RemoteAddr)
+	fmt.Fprintf(w, "database %s rolled back to version of %s\n",
+		name, db.Date().Format(http.TimeFormat))
 }
 
 // watchEvents logs and collect metrics of database events.
-func watchEvents(db *freegeoip.DB) {
-	for {
-		select {
-		case file := <-db.NotifyOpen():
-			log.Println("database loaded:", file)
+func watchEvents(name string, sub *freegeoip.Subscription) {
+	for ev := range sub.Events() {
+		switch ev.Type {
+		case freegeoip.EventDownloadStarted:
+			log.Printf("database %s download started", name)
+		case freegeoip.EventRollback:
+			log.Printf("database %s rolled back: %s", name, ev.File)
+			dbEventCounter.WithLabelValues("rolled_back").Inc()
+		case freegeoip.EventOverflow:
+			log.Printf("database %s events dropped", name)
+		case freegeoip.EventReload:
+			log.Printf("database %s loaded: %s", name, ev.File)
 			dbEventCounter.WithLabelValues("loaded").Inc()
-		case err := <-db.NotifyError():
-			log.Println("database error:", err)
+		case freegeoip.EventDownloadFinished:
+			if ev.Err == nil && ev.Checksum != "" {
+				log.Printf("database %s downloaded: %d bytes, sha256 %s", name, ev.Bytes, ev.Checksum)
+				dbEventCounter.WithLabelValues("downloaded").Inc()
+			}
+		case freegeoip.EventValidationFailed:
+			dbEventCounter.WithLabelValues("rejected").Inc()
+		case freegeoip.EventError:
+			log.Printf("database %s error: %s", name, ev.Err)
 			dbEventCounter.WithLabelValues("failed").Inc()
-		case msg := <-db.NotifyInfo():
-			log.Println("database info:", msg)
-		case <-db.NotifyClose():
-			return
+		case freegeoip.EventInfo:
+			log.Printf("database %s info: %s", name, ev.Message)
 		}
 	}
 }
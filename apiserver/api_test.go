@@ -7,31 +7,53 @@ package apiserver
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
+
+	"github.com/fiorix/freegeoip"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
-func newTestHandler() (http.Handler, error) {
-	_, f, _, _ := runtime.Caller(0)
+// testDBFile returns the path of the test database.
+func testDBFile() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "../testdata/db.gz")
+}
+
+// newTestHandler creates the handler of the test database, with the
+// configuration changed by fn, unless nil.
+func newTestHandler(t *testing.T, fn func(c *Config)) http.Handler {
 	c := NewConfig()
+	c.DB = testDBFile()
+	c.Silent = true
+	if fn != nil {
+		fn(c)
+	}
+	f, err := NewHandler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// rateLimitConfig serves the API under /api, with a rate limit.
+func rateLimitConfig(c *Config) {
 	c.APIPrefix = "/api"
 	c.PublicDir = "."
-	c.DB = filepath.Join(filepath.Dir(f), "../testdata/db.gz")
 	c.RateLimitLimit = 5
 	c.RateLimitBackend = "map"
-	c.Silent = true
-	return NewHandler(c)
 }
 
 func TestHandler(t *testing.T) {
-	f, err := newTestHandler()
-	if err != nil {
-		t.Fatal(err)
-	}
+	f := newTestHandler(t, rateLimitConfig)
 	w := &httptest.ResponseRecorder{Body: &bytes.Buffer{}}
 	r := &http.Request{
 		Method:     "GET",
@@ -46,7 +68,7 @@ func TestHandler(t *testing.T) {
 		Country string `json:"country_name"`
 		City    string `json:"city"`
 	}{}
-	if err = json.NewDecoder(w.Body).Decode(&m); err != nil {
+	if err := json.NewDecoder(w.Body).Decode(&m); err != nil {
 		t.Fatal(err)
 	}
 	if m.Country != "Venezuela" && m.City != "Caracas" {
@@ -55,11 +77,31 @@ func TestHandler(t *testing.T) {
 	}
 }
 
-func TestMetricsHandler(t *testing.T) {
-	f, err := newTestHandler()
-	if err != nil {
-		t.Fatal(err)
+func TestHandlerDatabases(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.Databases = "extra=" + c.DB
+	})
+	w := &httptest.ResponseRecorder{Body: &bytes.Buffer{}}
+	r := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: "/json/200.1.2.3"},
+		RemoteAddr: "[::1]:1905",
 	}
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	c := NewConfig()
+	c.DB = testDBFile()
+	c.Databases = "extra"
+	c.Silent = true
+	if _, err := NewHandler(c); err == nil {
+		t.Fatal("Unexpected handler with invalid database spec")
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	f := newTestHandler(t, rateLimitConfig)
 	tp := []http.Request{
 		{
 			Method:     "GET",
@@ -87,10 +129,7 @@ func TestMetricsHandler(t *testing.T) {
 }
 
 func TestWriters(t *testing.T) {
-	f, err := newTestHandler()
-	if err != nil {
-		t.Fatal(err)
-	}
+	f := newTestHandler(t, rateLimitConfig)
 	tp := []http.Request{
 		{
 			Method:     "GET",
@@ -107,6 +146,11 @@ func TestWriters(t *testing.T) {
 			URL:        &url.URL{Path: "/api/json/"},
 			RemoteAddr: "[::1]:1905",
 		},
+		{
+			Method:     "GET",
+			URL:        &url.URL{Path: "/api/ndjson/"},
+			RemoteAddr: "[::1]:1905",
+		},
 	}
 	for i, r := range tp {
 		w := &httptest.ResponseRecorder{Body: &bytes.Buffer{}}
@@ -118,33 +162,333 @@ func TestWriters(t *testing.T) {
 }
 
 func TestParseAcceptLanguage(t *testing.T) {
-	var names = make(map[string]string)
-	names["en"] = "Romania"
-	names["de"] = "Rumänien"
-	names["ro"] = "România"
-	names["fr"] = "Roumanie"
-	testParseAcceptLanguage(t, names, "de", "de")
-	testParseAcceptLanguage(t, names, "de-DE", "de")
-	testParseAcceptLanguage(t, names, "de-DE, en", "de")
-	testParseAcceptLanguage(t, names, "en-US, de-DE", "en")
-	testParseAcceptLanguage(t, names, "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "fr")
-	testParseAcceptLanguage(t, names, "en;q=0.1, de;q=0.8, fr;q=0.7, *;q=0.5", "de")
-
-	// less languages
-	names = make(map[string]string)
-	names["en"] = "Romania"
-	names["de"] = "Rumänien"
-	testParseAcceptLanguage(t, names, "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "en")
-
-	// no languages
-	names = make(map[string]string)
-	testParseAcceptLanguage(t, names, "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "en")
-}
-
-func testParseAcceptLanguage(t *testing.T, names map[string]string, header string, language string) {
-	result := parseAcceptLanguage(header, names)
+	// Languages are matched against the languages of the database,
+	// which has names in de, en, fr and others, but not ro.
+	db, err := freegeoip.Open(testDBFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	testParseAcceptLanguage(t, db, "de", "de")
+	testParseAcceptLanguage(t, db, "de-DE", "de")
+	testParseAcceptLanguage(t, db, "de-DE, en", "de")
+	testParseAcceptLanguage(t, db, "en-US, de-DE", "en")
+	testParseAcceptLanguage(t, db, "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "fr")
+	testParseAcceptLanguage(t, db, "en;q=0.1, de;q=0.8, fr;q=0.7, *;q=0.5", "de")
+
+	// languages not in the database
+	testParseAcceptLanguage(t, db, "ro-RO, ro;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "en")
+	testParseAcceptLanguage(t, db, "ro-RO, ro;q=0.9", "en")
+}
+
+func testParseAcceptLanguage(t *testing.T, db *freegeoip.DB, header string, language string) {
+	result := db.Language(header)
 
 	if result != language {
 		t.Fatalf("Parsed language '%s' from header '%s'  doesn't match language '%s'", result, header, language)
 	}
 }
+
+func TestCSVHeader(t *testing.T) {
+	f := newV2TestHandler(t)
+	for _, test := range []struct{ Path, Body string }{
+		{
+			"/csv/200.1.2.3?header=true",
+			"ip,country_code,country_name,region_code,region_name,city,zip_code,time_zone,latitude,longitude,metro_code\r\n" +
+				"200.1.2.3,VE,Venezuela,A,Distrito Federal,Caracas,1010,America/Caracas,10.5000,-66.9168,0\r\n",
+		},
+		{
+			"/csv/200.1.2.3?header=1&fields=country_code,city",
+			"country_code,city\r\nVE,Caracas\r\n",
+		},
+		{
+			"/csv/200.1.2.3?header=false",
+			"200.1.2.3,VE,Venezuela,A,Distrito Federal,Caracas,1010,America/Caracas,10.5000,-66.9168,0\r\n",
+		},
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest("GET", test.Path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != test.Body {
+			t.Errorf("Unexpected response to %s:\nwant %q\nhave %d %q", test.Path, test.Body, w.Code, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/csv/200.1.2.3?header=yes", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Unexpected response to invalid header parameter: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	f := newV2TestHandler(t)
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/ndjson/200.1.2.3?fields=country_code,city", nil))
+	want := `{"country_code":"VE","city":"Caracas"}` + "\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("Unexpected response: want %q, have %d %q", want, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Unexpected content type: %q", ct)
+	}
+	// The instrumented handler only flushes responses of net/http.
+	w = httptest.NewRecorder()
+	ndjsonWriter(w, httptest.NewRequest("GET", "/ndjson/", nil), &responseRecord{IP: "::1"})
+	if !w.Flushed {
+		t.Fatal("Unexpected response: not flushed")
+	}
+}
+
+func TestOpenDBLicenseKey(t *testing.T) {
+	c := NewConfig()
+	c.DB = testDBFile()
+	c.LicenseKey = "xxx"
+	db, err := openDB(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if c.DB != testDBFile() {
+		t.Fatalf("Unexpected database: %q", c.DB)
+	}
+}
+
+func TestVerifyOptions(t *testing.T) {
+	c := NewConfig()
+	c.DBSHA256URL = "http://localhost/db.gz.sha256"
+	c.DBSignatureURL = "http://localhost/db.gz.sig"
+	c.DBPublicKey = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	opts, err := verifyOptions(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts) != 2 {
+		t.Fatalf("Unexpected number of options: want 2, have %d", len(opts))
+	}
+	c.DBPublicKey = "bogus"
+	if _, err = verifyOptions(c); err == nil {
+		t.Fatal("Unexpected invalid public key was accepted")
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	c := NewConfig()
+	opts, err := validateOptions(c)
+	if err != nil || len(opts) != 0 {
+		t.Fatalf("Unexpected validation options: %d, %v", len(opts), err)
+	}
+	c.DBCanaries = "8.8.8.8=US, 200.1.2.3=VE"
+	opts, err = validateOptions(c)
+	if err != nil || len(opts) != 1 {
+		t.Fatalf("Unexpected validation options: %d, %v", len(opts), err)
+	}
+	for _, canaries := range []string{"8.8.8.8", "bogus=US", "8.8.8.8="} {
+		c.DBCanaries = canaries
+		if _, err = validateOptions(c); err == nil {
+			t.Fatalf("Unexpected invalid canaries were accepted: %q", canaries)
+		}
+	}
+}
+
+func TestRollbackHandler(t *testing.T) {
+	c := NewConfig()
+	c.DB = testDBFile()
+	c.Silent = true
+	_, admin, err := NewHandlers(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		Method string
+		URL    string
+		Code   int
+	}{
+		{"GET", "/admin/rollback", http.StatusMethodNotAllowed},
+		{"POST", "/admin/rollback?db=bogus", http.StatusNotFound},
+		{"POST", "/admin/rollback", http.StatusConflict}, // Not from a source.
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.URL, nil)
+		admin.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Fatalf("%s %s: unexpected response: want %d, have %d %s",
+				test.Method, test.URL, test.Code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	c := NewConfig()
+	c.S3Endpoint = "http://localhost:9000"
+	for _, test := range []struct {
+		DSN    string
+		Source string
+	}{
+		{"../testdata/db.gz", ""},
+		{"../testdata", "../testdata"},
+		{"https://example.com/db.gz", "https://example.com/db.gz"},
+		{"s3://geoip/GeoLite2-City.tar.gz", "http://localhost:9000/geoip/GeoLite2-City.tar.gz"},
+	} {
+		src, err := newSource(c, test.DSN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src == nil && test.Source != "" || src != nil && src.String() != test.Source {
+			t.Fatalf("%s: unexpected source: %v", test.DSN, src)
+		}
+	}
+	if _, err := newSource(c, "s3://geoip"); err == nil {
+		t.Fatal("Unexpected s3 source without key")
+	}
+}
+
+func TestLookupCacheMetrics(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.LookupCache = 10
+	})
+	for i := 0; i < 2; i++ {
+		w := &httptest.ResponseRecorder{Body: &bytes.Buffer{}}
+		r := &http.Request{
+			Method:     "GET",
+			URL:        &url.URL{Path: "/json/200.1.2.3"},
+			RemoteAddr: "[::1]:1905",
+		}
+		f.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+		}
+	}
+	ch := make(chan prometheus.Metric, 3)
+	lookupCacheMetrics.Collect(ch)
+	close(ch)
+	var values []float64
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		if pb.Counter != nil {
+			values = append(values, pb.Counter.GetValue())
+		} else {
+			values = append(values, pb.Gauge.GetValue())
+		}
+	}
+	// Hits, misses and entries. Client metrics look up the loopback
+	// address, which is not in the database.
+	want := []float64{1, 1, 1}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("Unexpected metrics: want %v, have %v", want, values)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.Databases = "extra=" + c.DB
+	})
+	w := httptest.NewRecorder()
+	r := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: "/api/status"},
+		RemoteAddr: "[::1]:1905",
+	}
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Databases map[string]struct {
+			DatabaseType string `json:"database_type"`
+			SHA256       string `json:"sha256"`
+			Error        string `json:"error"`
+		} `json:"databases"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{primaryDB, "extra"} {
+		db, ok := resp.Databases[name]
+		if !ok {
+			t.Fatalf("Missing database %q: %s", name, w.Body.String())
+		}
+		if db.DatabaseType != "GeoLite2-City" || db.SHA256 == "" || db.Error != "" {
+			t.Fatalf("Unexpected status of %q: %+v", name, db)
+		}
+	}
+}
+
+func TestHandlerOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	overlay := filepath.Join(dir, "overlay.csv")
+	err = ioutil.WriteFile(overlay, []byte("network,country,country_name\n200.1.2.3/32,AR,Argentina\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newTestHandler(t, func(c *Config) {
+		c.Overlay = overlay
+	})
+	w := httptest.NewRecorder()
+	r := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: "/csv/200.1.2.3"},
+		RemoteAddr: "[::1]:1905",
+	}
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	want := "200.1.2.3,AR,Argentina,A,Distrito Federal,Caracas,1010,America/Caracas,10.5000,-66.9168,0\r\n"
+	if w.Body.String() != want {
+		t.Fatalf("Unexpected response: want %q, have %q", want, w.Body.String())
+	}
+}
+
+func TestHandlerReserved(t *testing.T) {
+	f := newTestHandler(t, nil)
+	w := httptest.NewRecorder()
+	r := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: "/json/10.0.0.1"},
+		RemoteAddr: "[::1]:1905",
+	}
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	var m map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["reserved"] != true || m["scope"] != "private" {
+		t.Fatalf("Unexpected response: %v", m)
+	}
+
+	f = newTestHandler(t, func(c *Config) {
+		c.ReservedStatus = http.StatusUnprocessableEntity
+	})
+	for _, test := range []struct {
+		Path string
+		Code int
+	}{
+		{"/json/10.0.0.1", http.StatusUnprocessableEntity},
+		{"/csv/::1", http.StatusUnprocessableEntity},
+		{"/json/8.8.8.8", http.StatusOK},
+	} {
+		w = httptest.NewRecorder()
+		r.URL = &url.URL{Path: test.Path}
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("Unexpected response to %s: want %d, have %d %s", test.Path, test.Code, w.Code, w.Body.String())
+		}
+	}
+
+	c := NewConfig()
+	c.DB = testDBFile()
+	c.ReservedStatus = http.StatusOK
+	c.Silent = true
+	if _, err := NewHandler(c); err == nil {
+		t.Fatal("Unexpected handler with status 200 for reserved addresses")
+	}
+}
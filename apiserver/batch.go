@@ -0,0 +1,302 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-web/httprl"
+)
+
+// maxBatchItemSize is the size of items of batch requests, e.g. IPv6
+// addresses with quotes, for limiting the size of request bodies.
+const maxBatchItemSize = 64
+
+// batchResult is the result of an item of a batch request: the fields
+// of the response, or the reason the item failed.
+type batchResult struct {
+	XMLName xml.Name `xml:"Response" json:"-"`
+	Query   string   `json:"query"`
+	Error   string   `json:"error,omitempty" xml:",omitempty"`
+	*responseRecord
+}
+
+// selected returns the result with the selected fields only, as
+// responseRecord.selected does.
+func (res *batchResult) selected() interface{} {
+	if res.responseRecord == nil || res.fields == nil {
+		return res
+	}
+	return &batchProjection{res}
+}
+
+// batchProjection is a result of a batch request with its query and
+// the fields selected with the fields parameter only.
+type batchProjection struct {
+	*batchResult
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *batchProjection) MarshalJSON() ([]byte, error) {
+	query, err := json.Marshal(p.Query)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := (&projection{p.responseRecord, p.fields}).MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(`{"query":`)
+	b.Write(query)
+	b.WriteByte(',')
+	b.Write(fields[1:])
+	return b.Bytes(), nil
+}
+
+// MarshalXML implements the xml.Marshaler interface.
+func (p *batchProjection) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "Response"
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := e.EncodeElement(p.Query, xml.StartElement{Name: xml.Name{Local: "Query"}}); err != nil {
+		return err
+	}
+	if err := (&projection{p.responseRecord, p.fields}).encodeFields(e); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// batchParams are the parameters of a batch request for the writers
+// of its response, parsed before any address is looked up.
+type batchParams struct {
+	fields []*responseField // Selected fields, or nil for all.
+	header bool             // Write a header row, for CSV.
+}
+
+type batchWriterFunc func(w http.ResponseWriter, p *batchParams, results []*batchResult)
+
+// batchWriters are the writers of batch responses by format.
+var batchWriters = map[string]batchWriterFunc{
+	"csv":    csvBatchWriter,
+	"xml":    xmlBatchWriter,
+	"json":   jsonBatchWriter,
+	"ndjson": ndjsonBatchWriter,
+}
+
+// batch handles requests for looking up many IP addresses at once,
+// e.g. POST /batch?format=csv with a JSON array, CSV or one address
+// per line in the body. Results are in the order of the addresses,
+// and each address counts against the quota of the client. The fields
+// of results can be selected with the fields parameter, as in lookups.
+func (f *apiHandler) batch(w http.ResponseWriter, r *http.Request) {
+	format := r.FormValue("format")
+	if format == "" {
+		format = "json"
+	}
+	writer, ok := batchWriters[format]
+	if !ok {
+		http.Error(w, "unsupported format: "+format, http.StatusBadRequest)
+		return
+	}
+	var p batchParams
+	var err error
+	if p.header, err = boolParam(r, "header"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.fields, err = parseFields(r.FormValue("fields")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	names, err := f.selectNames(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := int64(f.conf.BatchLimit) * maxBatchItemSize
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	switch {
+	case err != nil && int64(len(body)) >= limit:
+		msg := fmt.Sprintf("request body too large, limit is %d bytes", limit)
+		http.Error(w, msg, http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queries, err := readBatch(bytes.NewReader(body), r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(queries) > f.conf.BatchLimit {
+		msg := fmt.Sprintf("too many addresses: %d, limit is %d", len(queries), f.conf.BatchLimit)
+		http.Error(w, msg, http.StatusRequestEntityTooLarge)
+		return
+	}
+	results := make([]*batchResult, len(queries))
+	limited := false
+	for i, query := range queries {
+		res := &batchResult{Query: query}
+		results[i] = res
+		// The rate limiter counts the request as the first item.
+		if limited || (i > 0 && !f.hit(r)) {
+			limited = true
+			res.Error = "rate limit exceeded"
+			continue
+		}
+		ip := net.ParseIP(query)
+		if ip == nil {
+			res.Error = "invalid IP address"
+			continue
+		}
+		q, err := f.lookup(ip, needsCity(p.fields))
+		if err != nil {
+			http.Error(w, "Try again later.", http.StatusServiceUnavailable)
+			return
+		}
+		if res.Error = f.rejectReserved(ip, !q.empty()); res.Error == "" {
+			res.responseRecord = q.Record(ip, names)
+			res.fields = p.fields
+		}
+	}
+	w.Header().Set("X-Database-Date", f.db.Date().Format(http.TimeFormat))
+	writer(w, &p, results)
+}
+
+// readBatch reads the addresses of the body of a batch request, in the
+// format of its content type: a JSON array, CSV with addresses in the
+// first column, or one address per line.
+func readBatch(body io.Reader, contentType string) ([]string, error) {
+	ct, _, _ := mime.ParseMediaType(contentType)
+	var queries []string
+	switch ct {
+	case "application/json":
+		if err := json.NewDecoder(body).Decode(&queries); err != nil {
+			return nil, fmt.Errorf("invalid JSON array of addresses: %s", err)
+		}
+	case "text/csv":
+		cr := csv.NewReader(body)
+		cr.FieldsPerRecord = -1
+		for {
+			row, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			query := strings.TrimSpace(row[0])
+			if len(queries) == 0 && query == "ip" {
+				continue // Header.
+			}
+			queries = append(queries, query)
+		}
+	default:
+		s := bufio.NewScanner(body)
+		for s.Scan() {
+			if query := strings.TrimSpace(s.Text()); query != "" {
+				queries = append(queries, query)
+			}
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return queries, nil
+}
+
+// hit counts a request against the quota of the client, as the rate
+// limiter does, and returns false if the quota is exceeded. Requests
+// are let through on errors of the backend, as by the rate limiter.
+func (f *apiHandler) hit(r *http.Request) bool {
+	if f.rl == nil {
+		return true
+	}
+	key := httprl.DefaultKeyMaker
+	if f.rl.KeyMaker != nil {
+		key = f.rl.KeyMaker
+	}
+	count, _, err := f.rl.Backend.Hit(key(r), f.rl.Interval)
+	if err != nil {
+		log.Printf("rate limiter error: %s", err)
+		return true
+	}
+	return count <= f.rl.Limit
+}
+
+func csvBatchWriter(w http.ResponseWriter, p *batchParams, results []*batchResult) {
+	columns := (&responseRecord{fields: p.fields}).csvHeader()
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if p.header {
+		cw.Write(append(append([]string{}, columns...), "error"))
+	}
+	for _, res := range results {
+		var fields []string
+		if res.responseRecord != nil {
+			fields = res.csvFields()
+		} else {
+			fields = make([]string, len(columns))
+			for i, name := range columns {
+				if name == "ip" {
+					fields[i] = res.Query
+				}
+			}
+		}
+		cw.Write(append(fields, res.Error))
+	}
+	cw.Flush()
+}
+
+func xmlBatchWriter(w http.ResponseWriter, p *batchParams, results []*batchResult) {
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"Responses"`
+		Results []interface{}
+	}{Results: selectedResults(results)})
+}
+
+func jsonBatchWriter(w http.ResponseWriter, p *batchParams, results []*batchResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(selectedResults(results))
+}
+
+// selectedResults returns the results with the selected fields only.
+func selectedResults(results []*batchResult) []interface{} {
+	selected := make([]interface{}, len(results))
+	for i, res := range results {
+		selected[i] = res.selected()
+	}
+	return selected
+}
+
+// ndjsonBatchWriter writes one result per line, flushing each one to
+// the client as it's written.
+func ndjsonBatchWriter(w http.ResponseWriter, p *batchParams, results []*batchResult) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	enc := json.NewEncoder(w)
+	for _, res := range results {
+		if err := enc.Encode(res.selected()); err != nil {
+			return
+		}
+		flush(w)
+	}
+}
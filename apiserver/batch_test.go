@@ -0,0 +1,274 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-web/httprl"
+)
+
+func newBatchRequest(url, contentType, body string) *http.Request {
+	r := httptest.NewRequest("POST", url, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func TestBatch(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.BatchLimit = 100
+	})
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, newBatchRequest("/batch", "application/json", `["200.1.2.3","bogus","8.8.8.8"]`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	var results []struct {
+		Query       string `json:"query"`
+		Error       string `json:"error"`
+		IP          string `json:"ip"`
+		CountryCode string `json:"country_code"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+	if results[0].IP != "200.1.2.3" || results[0].CountryCode != "VE" || results[0].Error != "" {
+		t.Fatalf("Unexpected result: %+v", results[0])
+	}
+	if results[1].Query != "bogus" || results[1].IP != "" || results[1].Error != "invalid IP address" {
+		t.Fatalf("Unexpected result: %+v", results[1])
+	}
+	if results[2].IP != "8.8.8.8" || results[2].CountryCode != "US" {
+		t.Fatalf("Unexpected result: %+v", results[2])
+	}
+}
+
+func TestBatchFormats(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.BatchLimit = 100
+	})
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, newBatchRequest("/batch?format=csv", "text/plain", "200.1.2.3\n\nbogus\n"))
+	want := "200.1.2.3,VE,Venezuela,A,Distrito Federal,Caracas,1010,America/Caracas,10.5000,-66.9168,0,\r\n" +
+		"bogus,,,,,,,,,,,invalid IP address\r\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("Unexpected response: want %q, have %d %q", want, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, newBatchRequest("/batch?format=csv&header=true", "text/plain", "bogus\n"))
+	want = "ip,country_code,country_name,region_code,region_name,city,zip_code,time_zone,latitude,longitude,metro_code,error\r\n" +
+		"bogus,,,,,,,,,,,invalid IP address\r\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("Unexpected response: want %q, have %d %q", want, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, newBatchRequest("/batch?format=ndjson", "text/plain", "200.1.2.3\nbogus\n"))
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" || len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], `{"query":"200.1.2.3","ip":"200.1.2.3","country_code":"VE",`) ||
+		lines[1] != `{"query":"bogus","error":"invalid IP address"}` {
+		t.Fatalf("Unexpected response: %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, newBatchRequest("/batch?format=xml", "text/csv", "ip,count\n200.1.2.3,1\nbogus,2\n"))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || strings.Count(body, "<Response>") != 2 ||
+		!strings.Contains(body, "<CountryCode>VE</CountryCode>") ||
+		!strings.Contains(body, "<Error>invalid IP address</Error>") {
+		t.Fatalf("Unexpected response: %d %s", w.Code, body)
+	}
+}
+
+func TestBatchFields(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.BatchLimit = 100
+	})
+	for _, test := range []struct {
+		URL, Body string
+		Code      int
+		Want      string
+	}{
+		{
+			"/batch?fields=country_code",
+			"200.1.2.3\nbogus\n",
+			http.StatusOK,
+			`[{"query":"200.1.2.3","country_code":"VE"},{"query":"bogus","error":"invalid IP address"}]` + "\n",
+		},
+		{
+			"/batch?format=ndjson&fields=city,ip",
+			"200.1.2.3\n",
+			http.StatusOK,
+			`{"query":"200.1.2.3","city":"Caracas","ip":"200.1.2.3"}` + "\n",
+		},
+		{
+			"/batch?format=csv&header=true&fields=ip,country_code",
+			"200.1.2.3\nbogus\n",
+			http.StatusOK,
+			"ip,country_code,error\r\n200.1.2.3,VE,\r\nbogus,,invalid IP address\r\n",
+		},
+		{
+			"/batch?format=csv&fields=country_code",
+			"bogus\n",
+			http.StatusOK,
+			",invalid IP address\r\n",
+		},
+		{
+			"/batch?fields=bogus",
+			"200.1.2.3\n",
+			http.StatusBadRequest,
+			"",
+		},
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, newBatchRequest(test.URL, "text/plain", test.Body))
+		if w.Code != test.Code || (test.Want != "" && w.Body.String() != test.Want) {
+			t.Errorf("Unexpected response to %s: want %d %q, have %d %q", test.URL, test.Code, test.Want, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, newBatchRequest("/batch?format=xml&fields=country_code", "text/plain", "200.1.2.3\n"))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "<Query>200.1.2.3</Query>") ||
+		!strings.Contains(body, "<CountryCode>VE</CountryCode>") || strings.Contains(body, "<City>") {
+		t.Fatalf("Unexpected response: %d %s", w.Code, body)
+	}
+}
+
+func TestNDJSONBatchWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	results := []*batchResult{
+		{Query: "::1", responseRecord: &responseRecord{IP: "::1"}},
+		{Query: "bogus", Error: "invalid IP address"},
+	}
+	ndjsonBatchWriter(w, &batchParams{}, results)
+	if n := strings.Count(w.Body.String(), "\n"); n != 2 || !w.Flushed {
+		t.Fatalf("Unexpected response: %d lines, flushed %t", n, w.Flushed)
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.BatchLimit = 2
+	})
+	for _, test := range []struct {
+		URL, ContentType, Body string
+		Code                   int
+	}{
+		{"/batch", "text/plain", "1.0.0.1\n1.0.0.2\n1.0.0.3\n", http.StatusRequestEntityTooLarge},
+		{"/batch", "application/json", `{"ip":"1.0.0.1"}`, http.StatusBadRequest},
+		{"/batch?format=yaml", "text/plain", "1.0.0.1\n", http.StatusBadRequest},
+		{"/batch?format=csv&header=bogus", "text/plain", "1.0.0.1\n", http.StatusBadRequest},
+		{"/batch?fields=bogus", "text/plain", "1.0.0.1\n", http.StatusBadRequest},
+		{"/batch", "text/plain", strings.Repeat("1", 1000), http.StatusRequestEntityTooLarge},
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, newBatchRequest(test.URL, test.ContentType, test.Body))
+		if w.Code != test.Code {
+			t.Errorf("Unexpected response to %q: want %d, have %d %s", test.Body, test.Code, w.Code, w.Body.String())
+		}
+	}
+}
+
+// countingBackend is a rate limiter backend that counts all hits
+// under the same key.
+type countingBackend struct {
+	count uint64
+}
+
+func (b *countingBackend) Hit(key string, ttlsec int32) (uint64, int32, error) {
+	b.count++
+	return b.count, ttlsec, nil
+}
+
+func TestBatchRateLimit(t *testing.T) {
+	c := NewConfig()
+	c.DB = testDBFile()
+	c.BatchLimit = 100
+	dbs, err := openDBs(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbs.Close()
+	backend := &countingBackend{count: 1} // Hit by the rate limiter.
+	f := &apiHandler{
+		db:   dbs.DB(primaryDB),
+		dbs:  dbs,
+		conf: c,
+		rl:   &httprl.RateLimiter{Backend: backend, Limit: 3, Interval: 3600},
+	}
+	w := httptest.NewRecorder()
+	f.batch(w, newBatchRequest("/batch", "text/plain", "1.0.0.1\n1.0.0.2\n1.0.0.3\n1.0.0.4\n1.0.0.5\n"))
+	var results []struct {
+		Error string `json:"error"`
+	}
+	if err = json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		limited := res.Error == "rate limit exceeded"
+		if limited != (i >= 3) {
+			t.Errorf("Unexpected result %d: %+v", i, res)
+		}
+	}
+	if backend.count != 4 {
+		t.Fatalf("Unexpected number of hits: %d", backend.count)
+	}
+	// Invalid parameters are rejected before any address is counted.
+	w = httptest.NewRecorder()
+	f.batch(w, newBatchRequest("/batch?format=csv&header=bogus", "text/plain", "1.0.0.1\n1.0.0.2\n"))
+	if w.Code != http.StatusBadRequest || backend.count != 4 {
+		t.Fatalf("Unexpected response to invalid parameters: %d, %d hits", w.Code, backend.count)
+	}
+}
+
+// failingBackend is a rate limiter backend that is unavailable.
+type failingBackend struct{}
+
+func (failingBackend) Hit(key string, ttlsec int32) (uint64, int32, error) {
+	return 0, 0, errors.New("unavailable")
+}
+
+func TestBatchRateLimitError(t *testing.T) {
+	c := NewConfig()
+	c.DB = testDBFile()
+	c.BatchLimit = 100
+	dbs, err := openDBs(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbs.Close()
+	f := &apiHandler{
+		db:   dbs.DB(primaryDB),
+		dbs:  dbs,
+		conf: c,
+		rl:   &httprl.RateLimiter{Backend: failingBackend{}, Limit: 1, Interval: 3600},
+	}
+	w := httptest.NewRecorder()
+	f.batch(w, newBatchRequest("/batch", "text/plain", "1.0.0.1\n1.0.0.2\n"))
+	if strings.Contains(w.Body.String(), "rate limit exceeded") {
+		t.Fatalf("Unexpected response: %s", w.Body.String())
+	}
+}
+
+func TestBatchDisabled(t *testing.T) {
+	f := newTestHandler(t, nil)
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, newBatchRequest("/batch", "text/plain", "1.0.0.1\n"))
+	if w.Code == http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -35,8 +35,27 @@ type Config struct {
 	WriteTimeout        time.Duration `envconfig:"WRITE_TIMEOUT"`
 	PublicDir           string        `envconfig:"PUBLIC"`
 	DB                  string        `envconfig:"DB"`
+	Databases           string        `envconfig:"DATABASES"`
+	MemoryMap           bool          `envconfig:"MMAP"`
+	LookupCache         int           `envconfig:"LOOKUP_CACHE"`
+	Overlay             string        `envconfig:"OVERLAY"`
+	DBSHA256            string        `envconfig:"DB_SHA256"`
+	DBSHA256URL         string        `envconfig:"DB_SHA256_URL"`
+	DBSignatureURL      string        `envconfig:"DB_SIGNATURE_URL"`
+	DBPublicKey         string        `envconfig:"DB_PUBLIC_KEY"`
+	DBType              string        `envconfig:"DB_TYPE"`
+	DBCanaries          string        `envconfig:"DB_CANARIES"`
+	DBVersions          int           `envconfig:"DB_VERSIONS"`
+	CacheDir            string        `envconfig:"CACHE_DIR"`
+	S3Endpoint          string        `envconfig:"S3_ENDPOINT"`
+	S3Region            string        `envconfig:"S3_REGION"`
+	S3AccessKeyID       string        `envconfig:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey   string        `envconfig:"S3_SECRET_ACCESS_KEY"`
 	UpdateInterval      time.Duration `envconfig:"UPDATE_INTERVAL"`
 	RetryInterval       time.Duration `envconfig:"RETRY_INTERVAL"`
+	ReservedStatus      int           `envconfig:"RESERVED_STATUS"`
+	BatchLimit          int           `envconfig:"BATCH_LIMIT"`
+	LangFallback        string        `envconfig:"LANG_FALLBACK"`
 	UseXForwardedFor    bool          `envconfig:"USE_X_FORWARDED_FOR"`
 	Silent              bool          `envconfig:"SILENT"`
 	LogToStdout         bool          `envconfig:"LOGTOSTDOUT"`
@@ -50,6 +69,7 @@ type Config struct {
 	RateLimitInterval   time.Duration `envconfig:"QUOTA_INTERVAL"`
 	InternalServerAddr  string        `envconfig:"INTERNAL_SERVER"`
 	UpdatesHost         string        `envconfig:"UPDATES_HOST"`
+	DownloadHost        string        `envconfig:"DOWNLOAD_HOST"`
 	LicenseKey          string        `envconfig:"LICENSE_KEY"`
 	UserID              string        `envconfig:"USER_ID"`
 	ProductID           string        `envconfig:"PRODUCT_ID"`
@@ -81,6 +101,10 @@ func NewConfig() *Config {
 		DB:                  freegeoip.MaxMindDB,
 		UpdateInterval:      24 * time.Hour,
 		RetryInterval:       2 * time.Hour,
+		DBVersions:          1,
+		BatchLimit:          0,
+		S3Endpoint:          "https://s3.amazonaws.com",
+		S3Region:            "us-east-1",
 		LogTimestamp:        true,
 		RedisAddr:           "localhost:6379",
 		RedisTimeout:        time.Second,
@@ -89,6 +113,7 @@ func NewConfig() *Config {
 		RateLimitBackend:    "redis",
 		RateLimitInterval:   time.Hour,
 		UpdatesHost:         "updates.maxmind.com",
+		DownloadHost:        "download.maxmind.com",
 		ProductID:           "GeoIP2-City",
 	}
 }
@@ -113,9 +138,28 @@ func (c *Config) AddFlags(fs *flag.FlagSet) {
 	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "Read timeout for HTTP and HTTPS client conns")
 	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "Write timeout for HTTP and HTTPS client conns")
 	fs.StringVar(&c.PublicDir, "public", c.PublicDir, "Public directory to serve at the {prefix}/ endpoint")
-	fs.StringVar(&c.DB, "db", c.DB, "IP database file or URL")
+	fs.StringVar(&c.DB, "db", c.DB, "IP database file, directory, URL, or S3 object (s3://bucket/key)")
+	fs.StringVar(&c.Databases, "databases", c.Databases, "Comma separated list of additional databases in form of name=file-or-url, e.g. asn=GeoLite2-ASN.mmdb.gz")
+	fs.StringVar(&c.DBSHA256, "db-sha256", c.DBSHA256, "Expected SHA-256 hex digest of the database downloaded from -db")
+	fs.StringVar(&c.DBSHA256URL, "db-sha256-url", c.DBSHA256URL, "URL of the SHA-256 checksum file (sha256sum format) of the database downloaded from -db")
+	fs.StringVar(&c.DBSignatureURL, "db-signature-url", c.DBSignatureURL, "URL of the detached ed25519 signature of the database downloaded from -db (requires db-public-key)")
+	fs.StringVar(&c.DBPublicKey, "db-public-key", c.DBPublicKey, "Base64 encoded ed25519 public key for verifying database signatures")
+	fs.StringVar(&c.DBType, "db-type", c.DBType, "Expected type of the database from -db (e.g. GeoLite2-City), checked before loading new versions")
+	fs.StringVar(&c.DBCanaries, "db-canaries", c.DBCanaries, "Comma separated ip=country pairs that new versions of the database from -db must resolve before loading (e.g. 8.8.8.8=US)")
+	fs.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "Directory of the local copies of databases downloaded from URLs (default $TMPDIR/freegeoip)")
+	fs.IntVar(&c.DBVersions, "db-versions", c.DBVersions, "Number of previous versions of downloaded databases to keep for rollbacks")
+	fs.StringVar(&c.S3Endpoint, "s3-endpoint", c.S3Endpoint, "Endpoint of the S3-compatible object store for s3://bucket/key databases")
+	fs.StringVar(&c.S3Region, "s3-region", c.S3Region, "Region of the S3-compatible object store")
+	fs.StringVar(&c.S3AccessKeyID, "s3-access-key-id", c.S3AccessKeyID, "Access key ID for the S3-compatible object store; empty for public objects")
+	fs.StringVar(&c.S3SecretAccessKey, "s3-secret-access-key", c.S3SecretAccessKey, "Secret access key for the S3-compatible object store")
+	fs.BoolVar(&c.MemoryMap, "mmap", c.MemoryMap, "Memory-map database files instead of loading them into memory")
+	fs.StringVar(&c.Overlay, "overlay", c.Overlay, "YAML or CSV file of network overrides applied on top of -db, e.g. country and city of corporate networks")
+	fs.IntVar(&c.LookupCache, "lookup-cache", c.LookupCache, "Number of lookup results per database to cache in memory by network (0 disables the cache)")
 	fs.DurationVar(&c.UpdateInterval, "update", c.UpdateInterval, "Database update check interval")
 	fs.DurationVar(&c.RetryInterval, "retry", c.RetryInterval, "Max time to wait before retrying to download database")
+	fs.IntVar(&c.ReservedStatus, "reserved-status", c.ReservedStatus, "HTTP status (4xx) of lookups of private, loopback and other reserved addresses without records, instead of an empty record (0 disables)")
+	fs.IntVar(&c.BatchLimit, "batch-limit", c.BatchLimit, "Max number of IP addresses per request to the {prefix}/batch endpoint (0 disables the endpoint)")
+	fs.StringVar(&c.LangFallback, "lang-fallback", c.LangFallback, "Comma separated languages of names of places without a name in the language of the request, e.g. en; * for any language")
 	fs.BoolVar(&c.UseXForwardedFor, "use-x-forwarded-for", c.UseXForwardedFor, "Use the X-Forwarded-For header when available (e.g. behind proxy)")
 	fs.BoolVar(&c.Silent, "silent", c.Silent, "Disable HTTP and HTTPS log request details")
 	fs.BoolVar(&c.LogToStdout, "logtostdout", c.LogToStdout, "Log to stdout instead of stderr")
@@ -127,11 +171,12 @@ func (c *Config) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.RateLimitBackend, "quota-backend", c.RateLimitBackend, "Backend for rate limiter: map, redis, or memcache")
 	fs.Uint64Var(&c.RateLimitLimit, "quota-max", c.RateLimitLimit, "Max requests per source IP per interval; set 0 to turn quotas off")
 	fs.DurationVar(&c.RateLimitInterval, "quota-interval", c.RateLimitInterval, "Quota expiration interval, per source IP querying the API")
-	fs.StringVar(&c.InternalServerAddr, "internal-server", c.InternalServerAddr, "Address in form of ip:port to listen on for metrics and pprof")
-	fs.StringVar(&c.UpdatesHost, "updates-host", c.UpdatesHost, "MaxMind Updates Host")
-	fs.StringVar(&c.LicenseKey, "license-key", c.LicenseKey, "MaxMind License Key (requires user-id)")
-	fs.StringVar(&c.UserID, "user-id", c.UserID, "MaxMind User ID (requires license-key)")
-	fs.StringVar(&c.ProductID, "product-id", c.ProductID, "MaxMind Product ID (e.g GeoIP2-City)")
+	fs.StringVar(&c.InternalServerAddr, "internal-server", c.InternalServerAddr, "Address in form of ip:port to listen on for metrics, pprof and admin endpoints")
+	fs.StringVar(&c.UpdatesHost, "updates-host", c.UpdatesHost, "MaxMind Updates Host (legacy updates protocol)")
+	fs.StringVar(&c.DownloadHost, "download-host", c.DownloadHost, "MaxMind Download Host")
+	fs.StringVar(&c.LicenseKey, "license-key", c.LicenseKey, "MaxMind License Key")
+	fs.StringVar(&c.UserID, "user-id", c.UserID, "MaxMind User ID for the legacy updates protocol (requires license-key)")
+	fs.StringVar(&c.ProductID, "product-id", c.ProductID, "MaxMind Product or Edition ID (e.g GeoIP2-City or GeoLite2-City)")
 	fs.StringVar(&c.NewrelicName, "newrelic-name", c.NewrelicName, "Newrepic APM application name")
 	fs.StringVar(&c.NewrelicKey, "newrelic-key", c.NewrelicKey, "Nerelic API key")
 }
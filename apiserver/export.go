@@ -0,0 +1,79 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/fiorix/freegeoip"
+)
+
+// exportRecord is the record of a network in NDJSON exports, with the
+// fields of the API responses. The ip field is the network address.
+type exportRecord struct {
+	Network string `json:"network"`
+	*responseRecord
+}
+
+// ExportOptions are the options of Export.
+type ExportOptions struct {
+	Format       string     // Output format: csv (the default) or ndjson.
+	Lang         string     // Language of names, as in the Accept-Language header.
+	LangFallback string     // Comma separated fallback languages, as in Config.LangFallback.
+	Within       *net.IPNet // Only export networks within this network, or all.
+}
+
+// Export writes the networks of the database to w, one per line, as
+// CSV or NDJSON with the fields of the API responses. It is used by
+// the export command of the freegeoip server.
+func Export(w io.Writer, db *freegeoip.DB, o *ExportOptions) error {
+	fallbackLangs, err := parseLangFallback(o.LangFallback)
+	if err != nil {
+		return err
+	}
+	var opts []freegeoip.NetworksOption
+	if o.Within != nil {
+		opts = append(opts, freegeoip.Within(o.Within))
+	}
+	var write func(network *net.IPNet, rr *responseRecord) error
+	flush := func() error { return nil }
+	switch o.Format {
+	case "", "csv":
+		cw := csv.NewWriter(w)
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		if err := cw.Write(append([]string{"network"}, csvHeader...)); err != nil {
+			return err
+		}
+		write = func(network *net.IPNet, rr *responseRecord) error {
+			return cw.Write(append([]string{network.String()}, rr.csvFields()...))
+		}
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		write = func(network *net.IPNet, rr *responseRecord) error {
+			return enc.Encode(&exportRecord{network.String(), rr})
+		}
+	default:
+		return fmt.Errorf("unsupported format: %q", o.Format)
+	}
+	names := &nameSelector{lang: db.Language(o.Lang), fallback: fallbackLangs}
+	err = db.Networks(func(network *net.IPNet, rec freegeoip.Record) error {
+		q := &geoipQuery{}
+		if err := rec.Decode(&q.DefaultQuery); err != nil {
+			return err
+		}
+		return write(network, q.Record(network.IP, names))
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	return flush()
+}
@@ -0,0 +1,56 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fiorix/freegeoip"
+)
+
+func TestExport(t *testing.T) {
+	db, err := freegeoip.Open(testDBFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, within, _ := net.ParseCIDR("200.0.0.0/8")
+	var b bytes.Buffer
+	if err = Export(&b, db, &ExportOptions{Within: within}); err != nil {
+		t.Fatal(err)
+	}
+	want := "network,ip,country_code,country_name,region_code,region_name,city,zip_code,time_zone,latitude,longitude,metro_code\n" +
+		"200.1.2.0/24,200.1.2.0,VE,Venezuela,A,Distrito Federal,Caracas,1010,America/Caracas,10.5000,-66.9168,0\n"
+	if b.String() != want {
+		t.Fatalf("Unexpected export:\nwant %q\nhave %q", want, b.String())
+	}
+	b.Reset()
+	if err = Export(&b, db, &ExportOptions{Format: "ndjson"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	var rec struct {
+		Network     string `json:"network"`
+		CountryName string `json:"country_name"`
+	}
+	if err = json.Unmarshal([]byte(lines[len(lines)-1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Network == "" || rec.CountryName == "" {
+		t.Fatalf("Unexpected record: %+v", rec)
+	}
+	for i, o := range []*ExportOptions{
+		{Format: "xml"},
+		{LangFallback: "bogus language"},
+	} {
+		if err = Export(&bytes.Buffer{}, db, o); err == nil {
+			t.Errorf("Test %d: unexpected export with %+v", i, o)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// responseField is a field of responseRecord that can be selected with
+// the fields parameter, e.g. fields=country_code,time_zone.
+type responseField struct {
+	name    string // Name in JSON and CSV responses, e.g. country_code.
+	xmlName string // Name in XML responses, e.g. CountryCode.
+	index   int    // Index of the field in responseRecord.
+	city    bool   // Whether the field is decoded from cities.
+}
+
+// responseFields are the fields of responseRecord by name.
+var responseFields = newResponseFields()
+
+func newResponseFields() map[string]*responseField {
+	cityFields := map[string]bool{
+		"region_code": true,
+		"region_name": true,
+		"city":        true,
+		"zip_code":    true,
+		"time_zone":   true,
+		"latitude":    true,
+		"longitude":   true,
+		"metro_code":  true,
+	}
+	fields := make(map[string]*responseField)
+	t := reflect.TypeOf(responseRecord{})
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = &responseField{
+			name:    name,
+			xmlName: sf.Name,
+			index:   i,
+			city:    cityFields[name],
+		}
+	}
+	return fields
+}
+
+// parseFields parses the fields parameter, a comma separated list of
+// names of fields. It returns nil if no fields are selected.
+func parseFields(s string) ([]*responseField, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var fields []*responseField
+	for _, name := range strings.Split(s, ",") {
+		f, ok := responseFields[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown field: %q", name)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// needsCity returns true if any of the fields is decoded from cities,
+// or all fields are selected.
+func needsCity(fields []*responseField) bool {
+	if fields == nil {
+		return true
+	}
+	for _, f := range fields {
+		if f.city {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the value of the field in the record.
+func (f *responseField) value(rr *responseRecord) interface{} {
+	return reflect.ValueOf(rr).Elem().Field(f.index).Interface()
+}
+
+// csv returns the value of the field in CSV responses.
+func (f *responseField) csv(rr *responseRecord) string {
+	switch v := f.value(rr).(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// projection is a response with the selected fields only, in the
+// order they were selected.
+type projection struct {
+	rr     *responseRecord
+	fields []*responseField
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *projection) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range p.fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		v, err := json.Marshal(f.value(p.rr))
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// MarshalXML implements the xml.Marshaler interface.
+func (p *projection) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "Response"
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := p.encodeFields(e); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// encodeFields encodes the selected fields as XML elements.
+func (p *projection) encodeFields(e *xml.Encoder) error {
+	for _, f := range p.fields {
+		el := xml.StartElement{Name: xml.Name{Local: f.xmlName}}
+		if err := e.EncodeElement(f.value(p.rr), el); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countryQuery is the part of freegeoip.DefaultQuery without cities,
+// for lookups of country-level fields only, which are faster as cities
+// are not decoded.
+type countryQuery struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+	IsAnonymous                  bool   `maxminddb:"is_anonymous"`
+	IsAnonymousVPN               bool   `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider            bool   `maxminddb:"is_hosting_provider"`
+	IsPublicProxy                bool   `maxminddb:"is_public_proxy"`
+	IsTorExitNode                bool   `maxminddb:"is_tor_exit_node"`
+	ConnectionType               string `maxminddb:"connection_type"`
+}
+
+// lookup looks up the IP address in all databases. Cities are only
+// decoded if city is set.
+func (f *apiHandler) lookup(ip net.IP, city bool) (*geoipQuery, error) {
+	q := &geoipQuery{}
+	if city {
+		return q, f.dbs.LookupAll(ip, &q.DefaultQuery)
+	}
+	var cq countryQuery
+	if err := f.dbs.LookupAll(ip, &cq); err != nil {
+		return q, err
+	}
+	q.Country = cq.Country
+	q.AutonomousSystemNumber = cq.AutonomousSystemNumber
+	q.AutonomousSystemOrganization = cq.AutonomousSystemOrganization
+	q.IsAnonymous = cq.IsAnonymous
+	q.IsAnonymousVPN = cq.IsAnonymousVPN
+	q.IsHostingProvider = cq.IsHostingProvider
+	q.IsPublicProxy = cq.IsPublicProxy
+	q.IsTorExitNode = cq.IsTorExitNode
+	q.ConnectionType = cq.ConnectionType
+	return q, nil
+}
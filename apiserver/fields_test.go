@@ -0,0 +1,118 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	f := newTestHandler(t, nil)
+	for _, test := range []struct {
+		Path, Body string
+		Code       int
+	}{
+		{
+			"/json/200.1.2.3?fields=country_code,time_zone",
+			`{"country_code":"VE","time_zone":"America/Caracas"}` + "\n",
+			http.StatusOK,
+		},
+		{
+			"/json/200.1.2.3?fields=latitude&callback=cb",
+			`cb({"latitude":10.5});`,
+			http.StatusOK,
+		},
+		{
+			"/xml/200.1.2.3?fields=ip,asn",
+			"<Response>\n\t<IP>200.1.2.3</IP>\n\t<ASN>0</ASN>\n</Response>\n",
+			http.StatusOK,
+		},
+		{
+			"/csv/200.1.2.3?fields=time_zone,country_code,latitude,reserved",
+			"America/Caracas,VE,10.5000,false\r\n",
+			http.StatusOK,
+		},
+		{
+			"/csv/10.0.0.1?fields=ip,scope",
+			"10.0.0.1,private\r\n",
+			http.StatusOK,
+		},
+		{
+			"/json/200.1.2.3?fields=country_code,bogus",
+			"unknown field: \"bogus\"\n",
+			http.StatusBadRequest,
+		},
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest("GET", test.Path, nil))
+		if w.Code != test.Code || w.Body.String() != test.Body {
+			t.Errorf("Unexpected response to %s:\nwant %d %q\nhave %d %q", test.Path, test.Code, test.Body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestFieldsNeedsCity(t *testing.T) {
+	for _, test := range []struct {
+		Fields string
+		City   bool
+	}{
+		{"", true},
+		{"ip,country_code,country_name,asn", false},
+		{"country_code,time_zone", true},
+	} {
+		fields, err := parseFields(test.Fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if needsCity(fields) != test.City {
+			t.Errorf("Unexpected needsCity(%q): want %v", test.Fields, test.City)
+		}
+	}
+}
+
+func TestLookupCountryFields(t *testing.T) {
+	c := NewConfig()
+	c.DB = testDBFile()
+	dbs, err := openDBs(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbs.Close()
+	f := &apiHandler{dbs: dbs, conf: c}
+	q, err := f.lookup(net.ParseIP("200.1.2.3"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Country.ISOCode != "VE" || q.Country.Names["en"] != "Venezuela" {
+		t.Fatalf("Unexpected country: %+v", q.Country)
+	}
+	if len(q.City.Names) != 0 || len(q.Region) != 0 || q.Location.TimeZone != "" {
+		t.Fatalf("Unexpected city: %+v %+v %+v", q.City, q.Region, q.Location)
+	}
+}
+
+func benchmarkLookup(b *testing.B, city bool) {
+	c := NewConfig()
+	c.DB = testDBFile()
+	dbs, err := openDBs(c)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbs.Close()
+	f := &apiHandler{dbs: dbs, conf: c}
+	ip := net.ParseIP("200.1.2.3")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = f.lookup(ip, city); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLookupCity(b *testing.B)    { benchmarkLookup(b, true) }
+func BenchmarkLookupCountry(b *testing.B) { benchmarkLookup(b, false) }
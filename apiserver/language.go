@@ -0,0 +1,89 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// anyLanguage is the fallback language for names in any language.
+const anyLanguage = "*"
+
+// nameSelector selects the names of places in responses.
+type nameSelector struct {
+	lang     string   // Language of the request, as in the database.
+	fallback []string // Languages of places without names in lang.
+	all      bool     // Whether v2 responses have names in all languages.
+}
+
+// selectNames returns the selector of names of the request, in the
+// language of the lang parameter, e.g. lang=de, or else of the
+// Accept-Language header.
+func (f *apiHandler) selectNames(r *http.Request) (*nameSelector, error) {
+	accept := r.FormValue("lang")
+	if accept == "" {
+		accept = r.Header.Get("Accept-Language")
+	}
+	all, err := boolParam(r, "names")
+	if err != nil {
+		return nil, err
+	}
+	return &nameSelector{lang: f.db.Language(accept), fallback: f.fallback, all: all}, nil
+}
+
+// name returns the name of the place in the language of the request,
+// or in the first fallback language the place has a name in.
+func (n *nameSelector) name(m map[string]string) string {
+	if name, ok := m[n.lang]; ok {
+		return name
+	}
+	for _, lang := range n.fallback {
+		if lang == anyLanguage {
+			return anyName(m)
+		}
+		if name, ok := m[lang]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// anyName returns the name of the first language of the place in
+// alphabetical order, for responses to be consistent.
+func anyName(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	langs := make([]string, 0, len(m))
+	for lang := range m {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return m[langs[0]]
+}
+
+// parseLangFallback parses the comma separated list of fallback
+// languages of Config.LangFallback, e.g. "en,*".
+func parseLangFallback(s string) ([]string, error) {
+	var langs []string
+	for _, lang := range strings.Split(s, ",") {
+		lang = strings.TrimSpace(lang)
+		switch {
+		case lang == "":
+			continue
+		case lang != anyLanguage:
+			if _, err := language.Parse(lang); err != nil {
+				return nil, fmt.Errorf("invalid fallback language: %q", lang)
+			}
+		}
+		langs = append(langs, lang)
+	}
+	return langs, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNameSelector(t *testing.T) {
+	names := map[string]string{"de": "Rumänien", "en": "Romania", "fr": "Roumanie"}
+	for _, test := range []struct {
+		lang     string
+		fallback []string
+		want     string
+	}{
+		{"de", nil, "Rumänien"},
+		{"ro", nil, ""},
+		{"ro", []string{"en"}, "Romania"},
+		{"ro", []string{"es", "fr", "en"}, "Roumanie"},
+		{"ro", []string{"es", "*"}, "Rumänien"},
+		{"ro", []string{"es"}, ""},
+	} {
+		n := &nameSelector{lang: test.lang, fallback: test.fallback}
+		if name := n.name(names); name != test.want {
+			t.Errorf("Unexpected name in %q with fallback %q: want %q, have %q", test.lang, test.fallback, test.want, name)
+		}
+	}
+	n := &nameSelector{lang: "ro", fallback: []string{"*"}}
+	if name := n.name(nil); name != "" {
+		t.Errorf("Unexpected name of place without names: %q", name)
+	}
+}
+
+func TestParseLangFallback(t *testing.T) {
+	langs, err := parseLangFallback(" en, pt-BR,*,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"en", "pt-BR", "*"}; !reflect.DeepEqual(langs, want) {
+		t.Fatalf("Unexpected fallback languages: want %q, have %q", want, langs)
+	}
+	if langs, err = parseLangFallback(""); err != nil || langs != nil {
+		t.Fatalf("Unexpected fallback languages of empty list: %q, %v", langs, err)
+	}
+	if _, err = parseLangFallback("en,x_y z"); err == nil {
+		t.Fatal("Unexpected success parsing invalid language")
+	}
+}
+
+func TestHandlerLang(t *testing.T) {
+	c := NewConfig()
+	c.DB = testDBFile()
+	c.Silent = true
+	c.LangFallback = "xx"
+	if _, err := NewHandler(c); err == nil {
+		t.Fatal("Unexpected success with invalid fallback language")
+	}
+	f := newV2TestHandler(t)
+	for _, test := range []struct {
+		path, accept string
+		want         string
+	}{
+		// The subdivision has no name in German.
+		{"/csv/200.1.2.3?lang=de", "", "200.1.2.3,VE,Venezuela,A,,Caracas,"},
+		{"/csv/200.1.2.3", "de-DE", "200.1.2.3,VE,Venezuela,A,,Caracas,"},
+		// The lang parameter overrides the Accept-Language header.
+		{"/csv/200.1.2.3?lang=en", "de-DE", "200.1.2.3,VE,Venezuela,A,Distrito Federal,Caracas,"},
+		// Unknown languages are English.
+		{"/csv/200.1.2.3?lang=ja", "", "200.1.2.3,VE,Venezuela,A,Distrito Federal,Caracas,"},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Language", test.accept)
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), test.want) {
+			t.Errorf("Unexpected response to %s (%s): want %q, have %d %q", test.path, test.accept, test.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandlerLangFallback(t *testing.T) {
+	f := newTestHandler(t, func(c *Config) {
+		c.LangFallback = "es,en"
+	})
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/csv/200.1.2.3?lang=de", nil))
+	want := "200.1.2.3,VE,Venezuela,A,Distrito Federal,Caracas,"
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), want) {
+		t.Fatalf("Unexpected response: want %q, have %d %q", want, w.Code, w.Body.String())
+	}
+}
+
+func TestV2Names(t *testing.T) {
+	f := newV2TestHandler(t)
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/json/200.1.2.3?names=true&lang=de", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	var rec v2Record
+	if err := json.NewDecoder(w.Body).Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	want := v2Names{"de": "Venezuela", "en": "Venezuela", "es": "Venezuela"}
+	if c := rec.Country; c == nil || c.Name != "Venezuela" || !reflect.DeepEqual(c.Names, want) {
+		t.Fatalf("Unexpected country: %+v", c)
+	}
+	if len(rec.Subdivisions) != 1 || rec.Subdivisions[0].Name != "" || rec.Subdivisions[0].Names["en"] != "Distrito Federal" {
+		t.Fatalf("Unexpected subdivisions: %+v", rec.Subdivisions)
+	}
+
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/xml/200.1.2.3?names=1", nil))
+	want2 := "\t\t<Names>\n\t\t\t<Name lang=\"de\">Caracas</Name>\n\t\t\t<Name lang=\"en\">Caracas</Name>\n\t\t</Names>\n"
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want2) {
+		t.Fatalf("Unexpected response: want names %q, have %d %q", want2, w.Code, w.Body.String())
+	}
+
+	// Names are omitted by default.
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/json/200.1.2.3", nil))
+	if strings.Contains(w.Body.String(), `"names"`) {
+		t.Fatalf("Unexpected names in response: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/json/200.1.2.3?names=maybe", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Unexpected response to invalid names parameter: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -39,7 +39,7 @@ func Run() {
 	if !c.LogTimestamp {
 		log.SetFlags(0)
 	}
-	f, err := NewHandler(c)
+	f, admin, err := NewHandlers(c)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -50,7 +50,7 @@ func Run() {
 		go runTLSServer(c, f)
 	}
 	if c.InternalServerAddr != "" {
-		go runInternalServer(c)
+		go runInternalServer(c, admin)
 	}
 	select {}
 }
@@ -132,8 +132,9 @@ func runTLSServer(c *Config, f http.Handler) {
 	log.Fatal(srv.Serve(ln))
 }
 
-func runInternalServer(c *Config) {
+func runInternalServer(c *Config, admin http.Handler) {
 	http.Handle("/metrics", prometheus.Handler())
+	http.Handle("/admin/", admin)
 	log.Println("freegeoip internal server starting on", c.InternalServerAddr)
 	log.Fatal(http.ListenAndServe(c.InternalServerAddr, nil))
 }
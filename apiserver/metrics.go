@@ -4,7 +4,12 @@
 
 package apiserver
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"sync"
+
+	"github.com/fiorix/freegeoip"
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 // Experimental metrics for Prometheus, might change in the future.
 
@@ -40,9 +45,70 @@ var clientConnsGauge = prometheus.NewGaugeVec(
 	[]string{"proto"},
 )
 
+// lookupCacheCollector collects the statistics of the lookup caches
+// of the databases of the server.
+type lookupCacheCollector struct {
+	mu  sync.Mutex
+	dbs *freegeoip.Manager
+}
+
+var (
+	lookupCacheHitsDesc = prometheus.NewDesc(
+		"freegeoip_lookup_cache_hits_total",
+		"Lookups served from the lookup cache",
+		[]string{"db"}, nil,
+	)
+	lookupCacheMissesDesc = prometheus.NewDesc(
+		"freegeoip_lookup_cache_misses_total",
+		"Lookups not found in the lookup cache",
+		[]string{"db"}, nil,
+	)
+	lookupCacheEntriesDesc = prometheus.NewDesc(
+		"freegeoip_lookup_cache_entries",
+		"Number of results in the lookup cache",
+		[]string{"db"}, nil,
+	)
+)
+
+var lookupCacheMetrics = &lookupCacheCollector{}
+
+func (c *lookupCacheCollector) set(dbs *freegeoip.Manager) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dbs = dbs
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *lookupCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lookupCacheHitsDesc
+	ch <- lookupCacheMissesDesc
+	ch <- lookupCacheEntriesDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *lookupCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	dbs := c.dbs
+	c.mu.Unlock()
+	if dbs == nil {
+		return
+	}
+	for _, name := range dbs.Names() {
+		db := dbs.DB(name)
+		if db == nil {
+			continue
+		}
+		stats := db.CacheStats()
+		ch <- prometheus.MustNewConstMetric(lookupCacheHitsDesc, prometheus.CounterValue, float64(stats.Hits), name)
+		ch <- prometheus.MustNewConstMetric(lookupCacheMissesDesc, prometheus.CounterValue, float64(stats.Misses), name)
+		ch <- prometheus.MustNewConstMetric(lookupCacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries), name)
+	}
+}
+
 func init() {
 	prometheus.MustRegister(dbEventCounter)
 	prometheus.MustRegister(clientCountryCounter)
 	prometheus.MustRegister(clientConnsGauge)
 	prometheus.MustRegister(clientIPProtoCounter)
+	prometheus.MustRegister(lookupCacheMetrics)
 }
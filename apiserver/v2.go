@@ -0,0 +1,354 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/fiorix/freegeoip"
+)
+
+// v2Query is the query of v2 responses, with all the fields of the
+// GeoIP2 databases.
+type v2Query struct {
+	City               freegeoip.CityRecord          `maxminddb:"city"`
+	Continent          freegeoip.ContinentRecord     `maxminddb:"continent"`
+	Country            freegeoip.CountryRecord       `maxminddb:"country"`
+	Location           freegeoip.LocationRecord      `maxminddb:"location"`
+	Postal             freegeoip.PostalRecord        `maxminddb:"postal"`
+	RegisteredCountry  freegeoip.CountryRecord       `maxminddb:"registered_country"`
+	RepresentedCountry freegeoip.CountryRecord       `maxminddb:"represented_country"`
+	Subdivisions       []freegeoip.SubdivisionRecord `maxminddb:"subdivisions"`
+	Traits             freegeoip.TraitsRecord        `maxminddb:"traits"`
+
+	// Fields of additional databases, as in freegeoip.DefaultQuery.
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+	IsAnonymous                  bool   `maxminddb:"is_anonymous"`
+	IsAnonymousVPN               bool   `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider            bool   `maxminddb:"is_hosting_provider"`
+	IsPublicProxy                bool   `maxminddb:"is_public_proxy"`
+	IsTorExitNode                bool   `maxminddb:"is_tor_exit_node"`
+	ConnectionType               string `maxminddb:"connection_type"`
+}
+
+// v2Record is the response of the v2 endpoints. Places are omitted
+// when the databases don't have them, and names are in one language,
+// unless all names are requested with the names parameter.
+type v2Record struct {
+	XMLName            xml.Name    `xml:"Response" json:"-"`
+	IP                 string      `json:"ip"`
+	Continent          *v2Place    `json:"continent,omitempty" xml:",omitempty"`
+	Country            *v2Place    `json:"country,omitempty" xml:",omitempty"`
+	RegisteredCountry  *v2Place    `json:"registered_country,omitempty" xml:",omitempty"`
+	RepresentedCountry *v2Place    `json:"represented_country,omitempty" xml:",omitempty"`
+	Subdivisions       []*v2Place  `json:"subdivisions,omitempty" xml:"Subdivisions>Subdivision,omitempty"`
+	City               *v2Place    `json:"city,omitempty" xml:",omitempty"`
+	PostalCode         string      `json:"postal_code,omitempty" xml:",omitempty"`
+	Location           *v2Location `json:"location,omitempty" xml:",omitempty"`
+	Traits             *v2Traits   `json:"traits,omitempty" xml:",omitempty"`
+	Reserved           bool        `json:"reserved,omitempty" xml:",omitempty"`
+	Scope              string      `json:"scope,omitempty" xml:",omitempty"`
+}
+
+// v2Place is a continent, country, subdivision or city of v2 responses.
+type v2Place struct {
+	GeoNameID         uint    `json:"geoname_id,omitempty" xml:"GeoNameID,omitempty"`
+	Code              string  `json:"code,omitempty" xml:",omitempty"`                 // Continents.
+	ISOCode           string  `json:"iso_code,omitempty" xml:",omitempty"`             // Countries and subdivisions.
+	IsInEuropeanUnion bool    `json:"is_in_european_union,omitempty" xml:",omitempty"` // Countries.
+	Type              string  `json:"type,omitempty" xml:",omitempty"`                 // Represented countries.
+	Name              string  `json:"name,omitempty" xml:",omitempty"`
+	Names             v2Names `json:"names,omitempty" xml:",omitempty"`
+}
+
+// v2Names are the names of a place by language, e.g. {"en": "Germany"}.
+type v2Names map[string]string
+
+// MarshalXML implements the xml.Marshaler interface, with a Name
+// element per language, e.g. <Name lang="en">Germany</Name>.
+func (n v2Names) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	langs := make([]string, 0, len(n))
+	for lang := range n {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, lang := range langs {
+		el := xml.StartElement{
+			Name: xml.Name{Local: "Name"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "lang"}, Value: lang}},
+		}
+		if err := e.EncodeElement(n[lang], el); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// v2Location is the location of v2 responses, with coordinates as in
+// the databases.
+type v2Location struct {
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	AccuracyRadius uint16  `json:"accuracy_radius,omitempty" xml:",omitempty"`
+	MetroCode      uint    `json:"metro_code,omitempty" xml:",omitempty"`
+	TimeZone       string  `json:"time_zone,omitempty" xml:",omitempty"`
+}
+
+// v2Traits are the traits of the network of v2 responses, from the
+// city, country and additional databases.
+type v2Traits struct {
+	ASN                 uint   `json:"asn,omitempty" xml:",omitempty"`
+	ASOrganization      string `json:"as_organization,omitempty" xml:",omitempty"`
+	ConnectionType      string `json:"connection_type,omitempty" xml:",omitempty"`
+	IsAnonymous         bool   `json:"is_anonymous,omitempty" xml:",omitempty"`
+	IsAnonymousProxy    bool   `json:"is_anonymous_proxy,omitempty" xml:",omitempty"`
+	IsAnonymousVPN      bool   `json:"is_anonymous_vpn,omitempty" xml:",omitempty"`
+	IsHostingProvider   bool   `json:"is_hosting_provider,omitempty" xml:",omitempty"`
+	IsPublicProxy       bool   `json:"is_public_proxy,omitempty" xml:",omitempty"`
+	IsSatelliteProvider bool   `json:"is_satellite_provider,omitempty" xml:",omitempty"`
+	IsTorExitNode       bool   `json:"is_tor_exit_node,omitempty" xml:",omitempty"`
+}
+
+type v2WriterFunc func(w http.ResponseWriter, r *http.Request, d *v2Record)
+
+// v2CSVHeader are the columns of v2 CSV responses, which flatten the
+// records: places have their GeoNames ID, code and name, and the first
+// two subdivisions are in columns of their own, as in the CSV databases
+// of MaxMind. Columns are empty where JSON responses omit the field,
+// except for booleans.
+var v2CSVHeader = []string{
+	"ip",
+	"continent_geoname_id", "continent_code", "continent_name",
+	"country_geoname_id", "country_code", "country_name", "is_in_european_union",
+	"registered_country_geoname_id", "registered_country_code", "registered_country_name",
+	"represented_country_geoname_id", "represented_country_code", "represented_country_name", "represented_country_type",
+	"subdivision_1_geoname_id", "subdivision_1_code", "subdivision_1_name",
+	"subdivision_2_geoname_id", "subdivision_2_code", "subdivision_2_name",
+	"city_geoname_id", "city_name", "postal_code",
+	"latitude", "longitude", "accuracy_radius", "metro_code", "time_zone",
+	"asn", "as_organization", "connection_type",
+	"is_anonymous", "is_anonymous_proxy", "is_anonymous_vpn", "is_hosting_provider",
+	"is_public_proxy", "is_satellite_provider", "is_tor_exit_node",
+	"reserved", "scope",
+}
+
+// v2CSVWriter writes the record as a CSV row. Places have one name
+// only, so all names can't be requested with the names parameter.
+func v2CSVWriter(w http.ResponseWriter, r *http.Request, d *v2Record) {
+	header, err := boolParam(r, "header")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if all, _ := boolParam(r, "names"); all {
+		http.Error(w, "names parameter is not supported in CSV", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if header {
+		cw.Write(v2CSVHeader)
+	}
+	cw.Write(d.csvFields())
+	cw.Flush()
+}
+
+// csvFields returns the fields of the record, as in v2CSVHeader.
+func (d *v2Record) csvFields() []string {
+	fields := []string{d.IP}
+	fields = append(fields, d.Continent.csvFields()...)
+	fields = append(fields, d.Country.csvFields()...)
+	fields = append(fields, strconv.FormatBool(d.Country != nil && d.Country.IsInEuropeanUnion))
+	fields = append(fields, d.RegisteredCountry.csvFields()...)
+	fields = append(fields, d.RepresentedCountry.csvFields()...)
+	if d.RepresentedCountry != nil {
+		fields = append(fields, d.RepresentedCountry.Type)
+	} else {
+		fields = append(fields, "")
+	}
+	for i := 0; i < 2; i++ {
+		var p *v2Place
+		if i < len(d.Subdivisions) {
+			p = d.Subdivisions[i]
+		}
+		fields = append(fields, p.csvFields()...)
+	}
+	city := d.City.csvFields()
+	fields = append(fields, city[0], city[2], d.PostalCode)
+	if l := d.Location; l != nil {
+		fields = append(fields,
+			strconv.FormatFloat(l.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(l.Longitude, 'f', -1, 64),
+			csvUint(uint(l.AccuracyRadius)),
+			csvUint(l.MetroCode),
+			l.TimeZone,
+		)
+	} else {
+		fields = append(fields, "", "", "", "", "")
+	}
+	t := d.Traits
+	if t == nil {
+		t = &v2Traits{}
+	}
+	fields = append(fields, csvUint(t.ASN), t.ASOrganization, t.ConnectionType)
+	for _, v := range []bool{
+		t.IsAnonymous, t.IsAnonymousProxy, t.IsAnonymousVPN, t.IsHostingProvider,
+		t.IsPublicProxy, t.IsSatelliteProvider, t.IsTorExitNode, d.Reserved,
+	} {
+		fields = append(fields, strconv.FormatBool(v))
+	}
+	return append(fields, d.Scope)
+}
+
+// csvFields returns the GeoNames ID, code and name of the place, or
+// empty fields if nil.
+func (p *v2Place) csvFields() []string {
+	if p == nil {
+		return []string{"", "", ""}
+	}
+	code := p.ISOCode
+	if code == "" {
+		code = p.Code
+	}
+	return []string{csvUint(p.GeoNameID), code, p.Name}
+}
+
+// csvUint formats n for CSV responses, or returns an empty string if
+// n is zero.
+func csvUint(n uint) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+func v2XMLWriter(w http.ResponseWriter, r *http.Request, d *v2Record) {
+	writeXML(w, d)
+}
+
+func v2JSONWriter(w http.ResponseWriter, r *http.Request, d *v2Record) {
+	writeJSON(w, r, d)
+}
+
+// v2lookup handles requests of the v2 endpoints, e.g. /v2/json/{host}.
+// Their records are nested, so fields can't be selected as in v1.
+func (f *apiHandler) v2lookup(writer v2WriterFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("fields") != "" {
+			http.Error(w, "fields parameter is not supported by v2 endpoints", http.StatusBadRequest)
+			return
+		}
+		names, err := f.selectNames(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ip := hostIP(r)
+		if ip == nil {
+			http.NotFound(w, r)
+			return
+		}
+		q := &v2Query{}
+		if err := f.dbs.LookupAll(ip, q); err != nil {
+			http.Error(w, "Try again later.", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Database-Date", f.db.Date().Format(http.TimeFormat))
+		if msg := f.rejectReserved(ip, !reflect.DeepEqual(*q, v2Query{})); msg != "" {
+			http.Error(w, msg, f.conf.ReservedStatus)
+			return
+		}
+		writer(w, r, q.Record(ip, names))
+	}
+}
+
+// Record returns the v2 response of the query, with the names selected
+// by n.
+func (q *v2Query) Record(ip net.IP, n *nameSelector) *v2Record {
+	r := &v2Record{
+		IP:                 ip.String(),
+		Country:            v2Country(&q.Country, n),
+		RegisteredCountry:  v2Country(&q.RegisteredCountry, n),
+		RepresentedCountry: v2Country(&q.RepresentedCountry, n),
+		PostalCode:         q.Postal.Code,
+	}
+	if c := q.Continent; c.Code != "" || c.GeoNameID != 0 || len(c.Names) > 0 {
+		r.Continent = &v2Place{GeoNameID: c.GeoNameID, Code: c.Code}
+		r.Continent.setNames(c.Names, n)
+	}
+	for _, sub := range q.Subdivisions {
+		p := &v2Place{GeoNameID: sub.GeoNameID, ISOCode: sub.ISOCode}
+		p.setNames(sub.Names, n)
+		r.Subdivisions = append(r.Subdivisions, p)
+	}
+	if c := q.City; c.GeoNameID != 0 || len(c.Names) > 0 {
+		r.City = &v2Place{GeoNameID: c.GeoNameID}
+		r.City.setNames(c.Names, n)
+	}
+	if loc := q.Location; loc != (freegeoip.LocationRecord{}) {
+		r.Location = &v2Location{
+			Latitude:       loc.Latitude,
+			Longitude:      loc.Longitude,
+			AccuracyRadius: loc.AccuracyRadius,
+			MetroCode:      loc.MetroCode,
+			TimeZone:       loc.TimeZone,
+		}
+	}
+	traits := v2Traits{
+		ASN:                 q.AutonomousSystemNumber,
+		ASOrganization:      q.AutonomousSystemOrganization,
+		ConnectionType:      q.ConnectionType,
+		IsAnonymous:         q.IsAnonymous,
+		IsAnonymousProxy:    q.Traits.IsAnonymousProxy,
+		IsAnonymousVPN:      q.IsAnonymousVPN,
+		IsHostingProvider:   q.IsHostingProvider,
+		IsPublicProxy:       q.IsPublicProxy,
+		IsSatelliteProvider: q.Traits.IsSatelliteProvider,
+		IsTorExitNode:       q.IsTorExitNode,
+	}
+	if traits != (v2Traits{}) {
+		r.Traits = &traits
+	}
+	if sp := freegeoip.LookupSpecialPurpose(ip); sp != nil {
+		r.Reserved, r.Scope = true, sp.Scope
+	}
+	return r
+}
+
+// v2Country returns the country of v2 responses, or nil if the
+// databases don't have it.
+func v2Country(c *freegeoip.CountryRecord, n *nameSelector) *v2Place {
+	if c.ISOCode == "" && c.GeoNameID == 0 && len(c.Names) == 0 {
+		return nil
+	}
+	p := &v2Place{
+		GeoNameID:         c.GeoNameID,
+		ISOCode:           c.ISOCode,
+		IsInEuropeanUnion: c.IsInEuropeanUnion,
+		Type:              c.Type,
+	}
+	p.setNames(c.Names, n)
+	return p
+}
+
+// setNames sets the name of the place selected by n, and all its names
+// if requested.
+func (p *v2Place) setNames(names map[string]string, n *nameSelector) {
+	p.Name = n.name(names)
+	if n.all && len(names) > 0 {
+		p.Names = names
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package apiserver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newV2TestHandler(t *testing.T) http.Handler {
+	return newTestHandler(t, func(c *Config) {
+		c.ReservedStatus = http.StatusUnprocessableEntity
+	})
+}
+
+func TestV1Compatibility(t *testing.T) {
+	f := newV2TestHandler(t)
+	for _, test := range []struct{ Path, Body string }{
+		{
+			"/json/200.1.2.3",
+			`{"ip":"200.1.2.3","country_code":"VE","country_name":"Venezuela","region_code":"A","region_name":"Distrito Federal","city":"Caracas","zip_code":"1010","time_zone":"America/Caracas","latitude":10.5,"longitude":-66.9168,"metro_code":0}` + "\n",
+		},
+		{
+			"/xml/200.1.2.3",
+			"<Response>\n\t<IP>200.1.2.3</IP>\n\t<CountryCode>VE</CountryCode>\n\t<CountryName>Venezuela</CountryName>\n\t<RegionCode>A</RegionCode>\n\t<RegionName>Distrito Federal</RegionName>\n\t<City>Caracas</City>\n\t<ZipCode>1010</ZipCode>\n\t<TimeZone>America/Caracas</TimeZone>\n\t<Latitude>10.5</Latitude>\n\t<Longitude>-66.9168</Longitude>\n\t<MetroCode>0</MetroCode>\n</Response>\n",
+		},
+		{
+			"/csv/200.1.2.3",
+			"200.1.2.3,VE,Venezuela,A,Distrito Federal,Caracas,1010,America/Caracas,10.5000,-66.9168,0\r\n",
+		},
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest("GET", test.Path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != test.Body {
+			t.Errorf("Unexpected response to %s:\nwant %q\nhave %d %q", test.Path, test.Body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestV2(t *testing.T) {
+	f := newV2TestHandler(t)
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/json/200.1.2.3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	var rec v2Record
+	if err := json.NewDecoder(w.Body).Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.IP != "200.1.2.3" || rec.PostalCode != "1010" || rec.Traits != nil || rec.Reserved {
+		t.Fatalf("Unexpected record: %+v", rec)
+	}
+	if c := rec.Continent; c == nil || c.Code != "SA" || c.Name != "South America" || c.GeoNameID == 0 {
+		t.Fatalf("Unexpected continent: %+v", c)
+	}
+	if c := rec.Country; c == nil || c.ISOCode != "VE" || c.Name != "Venezuela" || c.GeoNameID == 0 {
+		t.Fatalf("Unexpected country: %+v", c)
+	}
+	if len(rec.Subdivisions) != 1 || rec.Subdivisions[0].ISOCode != "A" || rec.Subdivisions[0].Name != "Distrito Federal" {
+		t.Fatalf("Unexpected subdivisions: %+v", rec.Subdivisions)
+	}
+	if c := rec.City; c == nil || c.Name != "Caracas" || c.GeoNameID == 0 {
+		t.Fatalf("Unexpected city: %+v", c)
+	}
+	// Coordinates are not rounded.
+	if l := rec.Location; l == nil || l.Latitude != 10.5 || l.Longitude != -66.9167 || l.AccuracyRadius != 50 {
+		t.Fatalf("Unexpected location: %+v", l)
+	}
+}
+
+func TestV2XML(t *testing.T) {
+	f := newV2TestHandler(t)
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/xml/200.1.2.3", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("Unexpected response: %d %s", w.Code, body)
+	}
+	for _, s := range []string{
+		"<Code>SA</Code>",
+		"<Subdivisions>\n\t\t<Subdivision>",
+		"<AccuracyRadius>50</AccuracyRadius>",
+	} {
+		if !strings.Contains(body, s) {
+			t.Fatalf("Unexpected response, missing %q:\n%s", s, body)
+		}
+	}
+}
+
+func TestV2CSV(t *testing.T) {
+	f := newV2TestHandler(t)
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/csv/200.1.2.3?header=true", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || len(rows[0]) != len(v2CSVHeader) || len(rows[1]) != len(v2CSVHeader) {
+		t.Fatalf("Unexpected rows: %q", rows)
+	}
+	rec := make(map[string]string)
+	for i, name := range rows[0] {
+		rec[name] = rows[1][i]
+	}
+	for name, want := range map[string]string{
+		"ip":                 "200.1.2.3",
+		"continent_code":     "SA",
+		"country_code":       "VE",
+		"country_name":       "Venezuela",
+		"subdivision_1_code": "A",
+		"subdivision_2_code": "",
+		"city_name":          "Caracas",
+		"latitude":           "10.5",
+		"longitude":          "-66.9167",
+		"accuracy_radius":    "50",
+		"asn":                "",
+		"is_anonymous":       "false",
+	} {
+		if rec[name] != want {
+			t.Errorf("Unexpected %s: want %q, have %q", name, want, rec[name])
+		}
+	}
+	if rec["city_geoname_id"] == "" {
+		t.Errorf("Missing city GeoNames ID: %q", rows[1])
+	}
+}
+
+func TestV2Errors(t *testing.T) {
+	f := newV2TestHandler(t)
+	for _, path := range []string{
+		"/v2/json/200.1.2.3?fields=ip",
+		"/v2/csv/200.1.2.3?fields=ip",
+		"/v2/csv/200.1.2.3?names=true",
+		"/v2/csv/200.1.2.3?header=bogus",
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected response to %s: %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestV2Reserved(t *testing.T) {
+	f := newV2TestHandler(t)
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest("GET", "/v2/json/10.0.0.1", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
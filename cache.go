@@ -0,0 +1,111 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// CacheOptions configures the local copy of the database that DBs
+// created by OpenURL and OpenSource keep. See the Cache option.
+//
+// The database file, its previous versions and other files kept
+// next to it are all named after the local copy. DBs that use the same
+// local copy, in the same process or not, share it: updates are
+// serialized by locking the file, so only one of them downloads new
+// versions, and the others load them.
+type CacheOptions struct {
+	// Dir is the directory of the local copy, $TMPDIR/freegeoip
+	// by default.
+	Dir string
+
+	// FileName is the file name of the local copy in Dir. By default
+	// it is derived from the location of the source, e.g. its URL, so
+	// DBs of different sources don't overwrite each other.
+	FileName string
+}
+
+// cacheFile returns the name of the local copy of the database from
+// src. The name is used by default, when not empty.
+func (o *CacheOptions) cacheFile(src Source, name string) string {
+	dir := o.Dir
+	if dir == "" {
+		dir = filepath.Dir(defaultDB)
+	}
+	if o.FileName != "" {
+		name = o.FileName
+	}
+	if name == "" {
+		// The extension is neutral, as the format of files is
+		// detected from their contents, e.g. .mmdb or .tar.gz.
+		name = "db-" + sha256Hex([]byte(src.String()))[:16] + ".db"
+	}
+	return filepath.Join(dir, name)
+}
+
+// mappedFile returns the name of the file in the cache directory that
+// the compressed database file dbfile is decompressed to for
+// memory-mapping. It is derived from the absolute path of dbfile, so
+// the files of users are never written to.
+func (o *CacheOptions) mappedFile(dbfile string) string {
+	dir := o.Dir
+	if dir == "" {
+		dir = filepath.Dir(defaultDB)
+	}
+	if abs, err := filepath.Abs(dbfile); err == nil {
+		dbfile = abs
+	}
+	return filepath.Join(dir, "mmap-"+sha256Hex([]byte(dbfile))[:16]+".mmdb")
+}
+
+// mappedInfo identifies the contents of a file decompressed for
+// memory-mapping, stored next to it. See mappedInfoFile.
+type mappedInfo struct {
+	Source string `json:"source"` // SHA-256 of the compressed file.
+	MD5    string `json:"md5"`    // MD5 of the decompressed file.
+}
+
+// mappedInfoFile returns the name of the file that stores the
+// mappedInfo of the decompressed file mapped.
+func mappedInfoFile(mapped string) string {
+	return mapped + ".source"
+}
+
+// readMappedInfo returns the MD5 checksum of the decompressed file
+// mapped if it was decompressed from a file with the SHA-256 checksum
+// sum, or false if it is missing or was decompressed from another file.
+func readMappedInfo(mapped, sum string) (string, bool) {
+	if _, err := os.Stat(mapped); err != nil {
+		return "", false
+	}
+	b, err := ioutil.ReadFile(mappedInfoFile(mapped))
+	if err != nil {
+		return "", false
+	}
+	var info mappedInfo
+	if err = json.Unmarshal(b, &info); err != nil || info.Source != sum {
+		return "", false
+	}
+	return info.MD5, info.MD5 != ""
+}
+
+// writeMappedInfo stores the checksums of the decompressed file mapped.
+func writeMappedInfo(mapped string, info *mappedInfo) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(mappedInfoFile(mapped), b, 0644)
+}
+
+// lockFile returns the name of the lock file of the database file.
+// Only the local copies of DBs of sources are locked, never the files
+// of users opened with Open.
+func lockFile(dbfile string) string {
+	return dbfile + ".lock"
+}
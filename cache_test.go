@@ -0,0 +1,85 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheFile(t *testing.T) {
+	a := &HTTPSource{URL: "http://a/db.gz"}
+	b := &HTTPSource{URL: "http://b/db.gz"}
+	o := &CacheOptions{}
+	if o.cacheFile(a, "") == o.cacheFile(b, "") {
+		t.Fatal("Unexpected same local copy for different sources")
+	}
+	if dir := filepath.Dir(o.cacheFile(a, "")); dir != filepath.Dir(defaultDB) {
+		t.Fatal("Unexpected directory:", dir)
+	}
+	if name := o.cacheFile(a, "city.db"); name != filepath.Join(filepath.Dir(defaultDB), "city.db") {
+		t.Fatal("Unexpected file name:", name)
+	}
+	o = &CacheOptions{Dir: "/var/cache/freegeoip", FileName: "city.mmdb"}
+	for _, name := range []string{"", "city.db"} {
+		if file := o.cacheFile(a, name); file != "/var/cache/freegeoip/city.mmdb" {
+			t.Fatal("Unexpected file name:", file)
+		}
+	}
+}
+
+func TestCacheShared(t *testing.T) {
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var downloads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		time.Sleep(100 * time.Millisecond) // Let the other DB wait.
+		w.Header().Set("ETag", `"1"`)
+		w.Write(data)
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var dbs []*DB
+	for i := 0; i < 2; i++ {
+		db, err := OpenURL(srv.URL, time.Hour, time.Minute, Cache(CacheOptions{Dir: dir}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+	if dbs[0].file != dbs[1].file || filepath.Dir(dbs[0].file) != dir {
+		t.Fatalf("Unexpected local copies: %s, %s", dbs[0].file, dbs[1].file)
+	}
+	for _, db := range dbs {
+		select {
+		case <-db.NotifyOpen():
+		case err := <-db.NotifyError():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out")
+		}
+	}
+	if n := atomic.LoadInt32(&downloads); n != 1 {
+		t.Fatalf("Unexpected number of downloads: want 1, have %d", n)
+	}
+}
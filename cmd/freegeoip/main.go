@@ -4,8 +4,30 @@
 
 package main
 
-import "github.com/fiorix/freegeoip/apiserver"
+import (
+	"log"
+	"os"
+
+	"github.com/fiorix/freegeoip/apiserver"
+	"github.com/fiorix/freegeoip/exporter"
+	"github.com/fiorix/freegeoip/importer"
+)
 
 func main() {
-	apiserver.Run()
+	var cmd func(args []string) error
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			cmd = exporter.Run
+		case "import":
+			cmd = importer.Run
+		}
+	}
+	if cmd == nil {
+		apiserver.Run()
+		return
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
 }
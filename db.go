@@ -5,8 +5,10 @@
 package freegeoip
 
 import (
-	"compress/gzip"
+	"bufio"
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -19,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/howeyc/fsnotify"
@@ -35,31 +38,58 @@ var (
 	defaultDB = filepath.Join(os.TempDir(), "freegeoip", "db.gz")
 
 	// MaxMindDB is the URL of the free MaxMind GeoLite2 database.
+	//
+	// MaxMind no longer serves the database at this URL, it now
+	// requires a license key. See MaxMindDownloadURL.
 	MaxMindDB = "http://geolite.maxmind.com/download/geoip/database/GeoLite2-City.mmdb.gz"
 )
 
 // DB is the IP geolocation database.
 type DB struct {
-	file        string            // Database file name.
-	checksum    string            // MD5 of the unzipped database file
-	reader      *maxminddb.Reader // Actual db object.
-	notifyQuit  chan struct{}     // Stop auto-update and watch goroutines.
-	notifyOpen  chan string       // Notify when a db file is open.
-	notifyError chan error        // Notify when an error occurs.
-	notifyInfo  chan string       // Notify random actions for logging
-	closed      bool              // Mark this db as closed.
-	lastUpdated time.Time         // Last time the db was updated.
-	mu          sync.RWMutex      // Protects all the above.
+	file        string          // Database file name.
+	checksum    string          // MD5 of the unzipped database file
+	sha256      string          // SHA-256 of the database file.
+	source      string          // Source of the database file, if any.
+	reader      atomic.Value    // Actual db object, a *refReader.
+	notifyQuit  chan struct{}   // Stop auto-update and watch goroutines.
+	notifyOpen  chan string     // Notify when a db file is open.
+	notifyError chan error      // Notify when an error occurs.
+	notifyInfo  chan string     // Notify random actions for logging
+	ready       chan struct{}   // Closed when the first db is loaded.
+	closed      bool            // Mark this db as closed.
+	lastUpdated time.Time       // Last time the db was updated.
+	loadedAt    time.Time       // Time the db was loaded.
+	rejected    map[string]bool // SHA-256 of rolled back db files.
+	mu          sync.RWMutex    // Protects all the above, except reader.
+	updateMu    sync.Mutex      // Serializes db file replacements.
+
+	subs       map[*Subscription]struct{} // Subscribers of events.
+	subsClosed bool                       // Subscribers got EventClose.
+	subsMu     sync.Mutex                 // Protects subs and subsClosed.
 
 	updateInterval   time.Duration // Update interval.
 	maxRetryInterval time.Duration // Max retry interval in case of failure.
+
+	mmap         bool         // Memory-map the database file.
+	verifier     verifier     // Verify downloads before using them.
+	validation   *Validation  // Validate new databases before loading them.
+	keepVersions int          // Number of previous db files to keep.
+	cache        CacheOptions // Local copy of the database.
+	lookupCache  *lookupCache // Cache of lookup results.
+	overlayFile  string       // File of the overlay, if any.
+	overlay      atomic.Value // Overrides of the overlay file, an *overlay.
 }
 
 // Open creates and initializes a DB from a local file.
 //
+// The file can be a MaxMind DB file (.mmdb), optionally compressed
+// with gzip (.mmdb.gz), or a tar archive containing one (.tar.gz) as
+// distributed by MaxMind. The format is detected from the contents
+// of the file, regardless of its name.
+//
 // The database file is monitored by fsnotify and automatically
 // reloads when the file is updated or overwritten.
-func Open(dsn string) (*DB, error) {
+func Open(dsn string, opts ...Option) (*DB, error) {
 	db := &DB{
 		file:        dsn,
 		notifyQuit:  make(chan struct{}),
@@ -67,7 +97,15 @@ func Open(dsn string) (*DB, error) {
 		notifyError: make(chan error, 1),
 		notifyInfo:  make(chan string, 1),
 	}
-	err := db.openFile()
+	for _, opt := range opts {
+		opt(db)
+	}
+	err := db.loadOverlay()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	err = db.openFile()
 	if err != nil {
 		db.Close()
 		return nil, err
@@ -81,6 +119,9 @@ func Open(dsn string) (*DB, error) {
 }
 
 // MaxMindUpdateURL generates the URL for MaxMind paid databases.
+//
+// It implements the legacy updates protocol, which MaxMind has retired
+// in favour of the license key downloads of MaxMindDownloadURL.
 func MaxMindUpdateURL(hostname, productID, userID, licenseKey string) (string, error) {
 	limiter := func(r io.Reader) *io.LimitedReader {
 		return &io.LimitedReader{R: r, N: 1 << 30}
@@ -127,10 +168,26 @@ func MaxMindUpdateURL(hostname, productID, userID, licenseKey string) (string, e
 
 // OpenURL creates and initializes a DB from a URL.
 // It automatically downloads and updates the file in background, and
-// keeps a local copy on $TMPDIR.
-func OpenURL(url string, updateInterval, maxRetryInterval time.Duration) (*DB, error) {
+// keeps a local copy on $TMPDIR, or as set by the Cache option.
+//
+// The URL may point to any of the file formats supported by Open.
+func OpenURL(url string, updateInterval, maxRetryInterval time.Duration, opts ...Option) (*DB, error) {
+	return OpenSource(&HTTPSource{URL: url}, updateInterval, maxRetryInterval, opts...)
+}
+
+// OpenSource creates and initializes a DB from a Source, e.g. an
+// HTTPSource, DirSource or S3Source. As with OpenURL, it automatically
+// fetches and updates the file in background, and keeps a local copy
+// on $TMPDIR, or as set by the Cache option.
+func OpenSource(src Source, updateInterval, maxRetryInterval time.Duration, opts ...Option) (*DB, error) {
+	return openSource("", src, updateInterval, maxRetryInterval, opts...)
+}
+
+// openSource creates and initializes a DB from a Source, keeping the
+// local copy of the database in a file with the given name unless set
+// by the Cache option. See CacheOptions.
+func openSource(name string, src Source, updateInterval, maxRetryInterval time.Duration, opts ...Option) (*DB, error) {
 	db := &DB{
-		file:             defaultDB,
 		notifyQuit:       make(chan struct{}),
 		notifyOpen:       make(chan string, 1),
 		notifyError:      make(chan error, 1),
@@ -138,9 +195,19 @@ func OpenURL(url string, updateInterval, maxRetryInterval time.Duration) (*DB, e
 		updateInterval:   updateInterval,
 		maxRetryInterval: maxRetryInterval,
 	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	db.file = db.cache.cacheFile(src, name)
+	db.source = redactURL(src.String())
+	err := db.loadOverlay()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 	db.openFile() // Optional, might fail.
-	go db.autoUpdate(url)
-	err := db.watchFile()
+	go db.autoUpdate(src)
+	err = db.watchFile()
 	if err != nil {
 		db.Close()
 		return nil, fmt.Errorf("fsnotify failed for %s: %s", db.file, err)
@@ -158,7 +225,13 @@ func (db *DB) watchFile() error {
 		return err
 	}
 	go db.watchEvents(watcher)
-	return watcher.Watch(dbdir)
+	if err = watcher.Watch(dbdir); err != nil {
+		return err
+	}
+	if db.overlayFile != "" && filepath.Dir(db.overlayFile) != dbdir {
+		return watcher.Watch(filepath.Dir(db.overlayFile))
+	}
+	return nil
 }
 
 func (db *DB) watchEvents(watcher *fsnotify.Watcher) {
@@ -166,7 +239,16 @@ func (db *DB) watchEvents(watcher *fsnotify.Watcher) {
 		select {
 		case ev := <-watcher.Event:
 			if ev.Name == db.file && (ev.IsCreate() || ev.IsModify()) {
-				db.openFile()
+				if err := db.openFile(); err != nil {
+					db.sendError(fmt.Errorf("failed to load %s: %s", db.file, err))
+				}
+			}
+			if ev.Name == db.overlayFile && (ev.IsCreate() || ev.IsModify()) {
+				if err := db.loadOverlay(); err != nil {
+					db.sendError(err) // Keep using the previous overlay.
+				} else {
+					db.sendInfo("reloaded overlay " + db.overlayFile)
+				}
 			}
 		case <-watcher.Error:
 		case <-db.notifyQuit:
@@ -178,62 +260,145 @@ func (db *DB) watchEvents(watcher *fsnotify.Watcher) {
 }
 
 func (db *DB) openFile() error {
+	return db.loadFile(false)
+}
+
+// loadFile loads the database file, unless it's the one already in
+// use. When rolling back, the file is allowed to be older than the
+// database in use.
+func (db *DB) loadFile(rollback bool) error {
 	reader, checksum, err := db.newReader(db.file)
 	if err != nil {
 		return err
 	}
+	db.mu.RLock()
+	loaded := db.current() != nil && db.checksum == checksum
+	db.mu.RUnlock()
+	if loaded {
+		reader.Close()
+		return nil
+	}
 	stat, err := os.Stat(db.file)
 	if err != nil {
+		reader.Close()
 		return err
 	}
-	db.setReader(reader, stat.ModTime(), checksum)
+	if db.validation != nil {
+		var cur *maxminddb.Reader
+		if r := db.acquire(nil); r != nil {
+			defer r.release(nil)
+			cur = r.Reader
+		}
+		if err = db.validation.validate(cur, reader, rollback); err != nil {
+			reader.Close()
+			db.publish(Event{Type: EventValidationFailed, Err: err})
+			return err
+		}
+	}
+	sum, _ := fileSHA256(db.file) // Optional, for Metadata.
+	db.setReader(reader, stat.ModTime(), checksum, sum)
 	return nil
 }
 
 func (db *DB) newReader(dbfile string) (*maxminddb.Reader, string, error) {
+	if db.mmap {
+		return db.newMappedReader(dbfile)
+	}
 	f, err := os.Open(dbfile)
 	if err != nil {
 		return nil, "", err
 	}
 	defer f.Close()
-	gzf, err := gzip.NewReader(f)
+	b, err := readDatabase(f)
+	if err != nil {
+		return nil, "", err
+	}
+	checksum := fmt.Sprintf("%x", md5.Sum(b))
+	mmdb, err := maxminddb.FromBytes(b)
+	return mmdb, checksum, err
+}
+
+// newMappedReader returns a reader that memory-maps the database file.
+// Compressed files are decompressed to the cache directory first, see
+// CacheOptions.mappedFile, unless they were already decompressed.
+func (db *DB) newMappedReader(dbfile string) (*maxminddb.Reader, string, error) {
+	f, err := os.Open(dbfile)
 	if err != nil {
 		return nil, "", err
 	}
-	defer gzf.Close()
-	b, err := ioutil.ReadAll(gzf)
+	defer f.Close()
+	br := bufio.NewReader(f)
+	format, err := detectFormat(br)
 	if err != nil {
 		return nil, "", err
 	}
-	checksum := fmt.Sprintf("%x", md5.Sum(b))
-	mmdb, err := maxminddb.FromBytes(b)
+	if format == formatMMDB {
+		md5hash := md5.New()
+		if _, err = io.Copy(md5hash, br); err != nil {
+			return nil, "", err
+		}
+		mmdb, err := maxminddb.Open(dbfile)
+		return mmdb, hex.EncodeToString(md5hash.Sum(nil)), err
+	}
+	sum, err := fileSHA256(dbfile)
+	if err != nil {
+		return nil, "", err
+	}
+	mapped := db.cache.mappedFile(dbfile)
+	checksum, ok := readMappedInfo(mapped, sum)
+	if !ok {
+		if err = os.MkdirAll(filepath.Dir(mapped), 0755); err != nil {
+			return nil, "", err
+		}
+		md5hash := md5.New()
+		if err = extractFile(mapped, br, md5hash); err != nil {
+			return nil, "", err
+		}
+		checksum = hex.EncodeToString(md5hash.Sum(nil))
+		err = writeMappedInfo(mapped, &mappedInfo{Source: sum, MD5: checksum})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	mmdb, err := maxminddb.Open(mapped)
 	return mmdb, checksum, err
 }
 
-func (db *DB) setReader(reader *maxminddb.Reader, modtime time.Time, checksum string) {
+func (db *DB) setReader(reader *maxminddb.Reader, modtime time.Time, checksum, sha256sum string) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	if db.closed {
 		reader.Close()
 		return
 	}
-	if db.reader != nil {
-		db.reader.Close()
+	db.swapReader(reader)
+	if db.lookupCache != nil {
+		db.lookupCache.purge(db.current())
 	}
-	db.reader = reader
 	db.lastUpdated = modtime.UTC()
+	db.loadedAt = time.Now().UTC()
 	db.checksum = checksum
+	db.sha256 = sha256sum
+	if db.ready == nil {
+		db.ready = make(chan struct{})
+	}
+	select {
+	case <-db.ready:
+	default:
+		close(db.ready)
+	}
 	select {
 	case db.notifyOpen <- db.file:
 	default:
 	}
+	db.publish(Event{Type: EventReload, Checksum: checksum})
 }
 
-func (db *DB) autoUpdate(url string) {
+func (db *DB) autoUpdate(src Source) {
 	backoff := time.Second
 	for {
 		db.sendInfo("starting update")
-		err := db.runUpdate(url)
+		err := redactError(db.runUpdate(src))
 		if err != nil {
 			bs := backoff.Seconds()
 			ms := db.maxRetryInterval.Seconds()
@@ -252,68 +417,146 @@ func (db *DB) autoUpdate(url string) {
 	}
 }
 
-func (db *DB) runUpdate(url string) error {
-	yes, err := db.needUpdate(url)
+func (db *DB) runUpdate(src Source) error {
+	if _, err := db.makeDir(); err != nil {
+		return err
+	}
+	// Other DBs might be updating the same file, maybe in another
+	// process. Wait for them, then check the version they fetched.
+	unlock, err := lock(lockFile(db.file))
 	if err != nil {
 		return err
 	}
+	defer unlock()
+	var url string
+	if hs, ok := src.(*HTTPSource); ok {
+		url = hs.URL
+	}
+	checksum, err := db.verifier.checksum(url)
+	if err != nil {
+		return err
+	}
+	cur := db.localVersion(src)
+	var yes bool
+	if checksum != "" {
+		yes = verifySHA256(db.file, checksum) != nil && !db.isRejected(checksum)
+	} else {
+		yes, err = src.Check(cur)
+		if err != nil {
+			return err
+		}
+	}
 	if !yes {
-		return nil
+		return db.openLocal()
 	}
-	tmpfile, err := db.download(url)
+	tmpfile, version, err := db.fetch(src, cur)
 	if err != nil {
 		return err
 	}
-	err = db.renameFile(tmpfile)
+	if tmpfile == "" {
+		return db.openLocal()
+	}
+	err = db.verifier.verify(tmpfile, checksum)
 	if err != nil {
-		// Cleanup the tempfile if renaming failed.
 		os.RemoveAll(tmpfile)
+		return err
 	}
-	return err
-}
-
-func (db *DB) needUpdate(url string) (bool, error) {
-	stat, err := os.Stat(db.file)
+	rejected, err := db.isRejectedFile(tmpfile)
+	if err != nil || rejected {
+		os.RemoveAll(tmpfile)
+		if err == nil {
+			writeVersion(db.file, src, version) // Don't fetch it again.
+		}
+		return err
+	}
+	err = db.installFile(tmpfile)
 	if err != nil {
-		return true, nil // Local db is missing, must be downloaded.
+		return err
 	}
+	return writeVersion(db.file, src, version)
+}
 
-	resp, err := http.Head(url)
+// installFile replaces the database file with the given file and loads
+// it, rolling back to the previous version if it fails to load.
+func (db *DB) installFile(name string) error {
+	db.updateMu.Lock()
+	defer db.updateMu.Unlock()
+	err := db.renameFile(name)
 	if err != nil {
-		return false, err
+		// Cleanup the tempfile if renaming failed.
+		os.RemoveAll(name)
+		return err
 	}
-	defer resp.Body.Close()
+	err = db.openFile()
+	if err == nil {
+		return nil
+	}
+	if rerr := db.rollback(); rerr != nil {
+		return fmt.Errorf("failed to load new database: %s (rollback failed: %s)", err, rerr)
+	}
+	return fmt.Errorf("failed to load new database, rolled back: %s", err)
+}
 
-	// Check X-Database-MD5 if it exists
-	headerMd5 := resp.Header.Get("X-Database-MD5")
-	if len(headerMd5) > 0 && db.checksum != headerMd5 {
-		return true, nil
+// openLocal loads the local copy of the database if no database is
+// loaded yet, e.g. when another DB that shares the local copy fetched
+// it before this DB started watching the file.
+func (db *DB) openLocal() error {
+	if db.current() != nil {
+		return nil
 	}
+	return db.openFile()
+}
 
-	if stat.Size() != resp.ContentLength {
-		return true, nil
+// localVersion returns the version of the local copy of the database
+// file from src, or nil if there's no local copy.
+func (db *DB) localVersion(src Source) *Version {
+	stat, err := os.Stat(db.file)
+	if err != nil {
+		return nil
 	}
-	return false, nil
+	v := readVersion(db.file, src)
+	if v == nil {
+		v = &Version{}
+	}
+	v.Size = stat.Size()
+	db.mu.RLock()
+	v.MD5 = db.checksum
+	db.mu.RUnlock()
+	return v
 }
 
-func (db *DB) download(url string) (tmpfile string, err error) {
-	resp, err := http.Get(url)
+// fetch fetches the database file from src to a temporary file next to
+// the database file, unless the source has the version cur. It returns
+// the name of the file and its version, or an empty name if the
+// database was not modified.
+func (db *DB) fetch(src Source, cur *Version) (tmpfile string, v *Version, err error) {
+	dbdir, err := db.makeDir()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	defer resp.Body.Close()
-	tmpfile = filepath.Join(os.TempDir(),
-		fmt.Sprintf("_freegeoip.%d.db.gz", time.Now().UnixNano()))
-	f, err := os.Create(tmpfile)
+	f, err := ioutil.TempFile(dbdir, "_"+filepath.Base(db.file))
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
+	tmpfile = f.Name()
+	db.publish(Event{Type: EventDownloadStarted})
+	h := sha256.New()
+	v, err = src.Fetch(io.MultiWriter(f, h), cur)
 	if err != nil {
-		return "", err
-	}
-	return tmpfile, nil
+		os.Remove(tmpfile)
+		if err == ErrNotModified {
+			err = nil
+		}
+		db.publish(Event{Type: EventDownloadFinished, Err: err})
+		return "", nil, err
+	}
+	db.publish(Event{
+		Type:     EventDownloadFinished,
+		Bytes:    v.Size,
+		Checksum: hex.EncodeToString(h.Sum(nil)),
+	})
+	return tmpfile, v, nil
 }
 
 func (db *DB) makeDir() (dbdir string, err error) {
@@ -329,7 +572,7 @@ func (db *DB) makeDir() (dbdir string, err error) {
 }
 
 func (db *DB) renameFile(name string) error {
-	os.Rename(db.file, db.file+".bak") // Optional, might fail.
+	db.rotateBackups()
 	_, err := db.makeDir()
 	if err != nil {
 		return err
@@ -353,18 +596,23 @@ func (db *DB) NotifyClose() <-chan struct{} {
 // NotifyOpen returns a channel that notifies when a new database is
 // loaded or reloaded. This can be used to monitor background updates
 // when the DB points to a URL.
+//
+// Notifications are dropped when nobody is receiving them. See
+// Subscribe for a stream of all events.
 func (db *DB) NotifyOpen() (filename <-chan string) {
 	return db.notifyOpen
 }
 
 // NotifyError returns a channel that notifies when an error occurs
-// while downloading or reloading a DB that points to a URL.
+// while downloading or reloading a DB that points to a URL. Errors are
+// dropped when nobody is receiving them, as with NotifyOpen.
 func (db *DB) NotifyError() (errChan <-chan error) {
 	return db.notifyError
 }
 
 // NotifyInfo returns a channel that notifies informational messages
-// while downloading or reloading.
+// while downloading or reloading. Messages are dropped when nobody is
+// receiving them, as with NotifyOpen.
 func (db *DB) NotifyInfo() <-chan string {
 	return db.notifyInfo
 }
@@ -379,6 +627,7 @@ func (db *DB) sendError(err error) {
 	case db.notifyError <- err:
 	default:
 	}
+	db.publish(Event{Type: EventError, Err: err})
 }
 
 func (db *DB) sendInfo(message string) {
@@ -391,6 +640,7 @@ func (db *DB) sendInfo(message string) {
 	case db.notifyInfo <- message:
 	default:
 	}
+	db.publish(Event{Type: EventInfo, Message: message})
 }
 
 // Lookup performs a database lookup of the given IP address, and stores
@@ -398,17 +648,64 @@ func (db *DB) sendInfo(message string) {
 // with specific fields and tags as described here:
 // https://godoc.org/github.com/oschwald/maxminddb-golang#Reader.Lookup
 //
-// See the DefaultQuery for an example of the result struct.
+// See the DefaultQuery for an example of the result struct, and
+// LookupCity, LookupCountry and LookupASN for typed lookups.
 func (db *DB) Lookup(addr net.IP, result interface{}) error {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-	if db.reader != nil {
-		return db.reader.Lookup(addr, result)
+	r := db.acquire(addr)
+	if r == nil {
+		return ErrUnavailable
+	}
+	defer r.release(addr)
+	var err error
+	if db.lookupCache != nil {
+		err = db.lookupCache.lookup(r, addr, result)
+	} else {
+		err = r.Lookup(addr, result)
+	}
+	if err != nil {
+		return err
+	}
+	if o := db.matchOverlay(addr); o != nil {
+		o.apply(result)
+	}
+	return nil
+}
+
+// WaitReady blocks until the database is loaded, which might take a
+// while for DBs that point to a URL, or the context is done. It returns
+// the error of the context when it's done first, and ErrUnavailable
+// if the DB is closed.
+func (db *DB) WaitReady(ctx context.Context) error {
+	db.mu.Lock()
+	if db.ready == nil {
+		db.ready = make(chan struct{})
+	}
+	ready := db.ready
+	db.mu.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-db.notifyQuit:
+		return ErrUnavailable
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LookupContext performs a database lookup like Lookup, waiting for the
+// database to be loaded first. See WaitReady.
+func (db *DB) LookupContext(ctx context.Context, addr net.IP, result interface{}) error {
+	if err := db.WaitReady(ctx); err != nil {
+		return err
 	}
-	return ErrUnavailable
+	return db.Lookup(addr, result)
 }
 
 // DefaultQuery is the default query used for database lookups.
+//
+// Besides the fields of the GeoIP2-City database it has the fields of
+// the ASN, Anonymous-IP and Connection-Type databases, so it can be
+// used with Manager.LookupAll to merge the response of all of them.
 type DefaultQuery struct {
 	Continent struct {
 		Names map[string]string `maxminddb:"names"`
@@ -433,6 +730,20 @@ type DefaultQuery struct {
 	Postal struct {
 		Code string `maxminddb:"code"`
 	} `maxminddb:"postal"`
+
+	// Fields of the GeoIP2-ASN and GeoLite2-ASN databases.
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+
+	// Fields of the GeoIP2-Anonymous-IP database.
+	IsAnonymous       bool `maxminddb:"is_anonymous"`
+	IsAnonymousVPN    bool `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider bool `maxminddb:"is_hosting_provider"`
+	IsPublicProxy     bool `maxminddb:"is_public_proxy"`
+	IsTorExitNode     bool `maxminddb:"is_tor_exit_node"`
+
+	// Fields of the GeoIP2-Connection-Type database.
+	ConnectionType string `maxminddb:"connection_type"`
 }
 
 // Close closes the database.
@@ -445,9 +756,12 @@ func (db *DB) Close() {
 		close(db.notifyOpen)
 		close(db.notifyError)
 		close(db.notifyInfo)
+		db.publish(Event{Type: EventClose})
+	}
+	if db.current() != nil {
+		db.swapReader(nil)
 	}
-	if db.reader != nil {
-		db.reader.Close()
-		db.reader = nil
+	if db.lookupCache != nil {
+		db.lookupCache.purge(nil)
 	}
 }
@@ -5,7 +5,9 @@
 package freegeoip
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -56,7 +58,7 @@ func TestDownload(t *testing.T) {
 		t.Skip("Test database already exists:", testFile)
 	}
 	db := &DB{}
-	dbfile, err := db.download(MaxMindDB)
+	dbfile, _, err := db.fetch(&HTTPSource{URL: MaxMindDB}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,7 +70,8 @@ func TestDownload(t *testing.T) {
 
 func TestNeedUpdateFileMissing(t *testing.T) {
 	db := &DB{file: "does-not-exist"}
-	yes, err := db.needUpdate("whatever")
+	src := &HTTPSource{URL: "whatever"}
+	yes, err := src.Check(db.localVersion(src))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,7 +86,8 @@ func TestNeedUpdateSameFile(t *testing.T) {
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
 	db := &DB{file: testFile}
-	yes, err := db.needUpdate(srv.URL + "/" + testFile)
+	src := &HTTPSource{URL: srv.URL + "/" + testFile}
+	yes, err := src.Check(db.localVersion(src))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -109,7 +113,8 @@ func TestNeedUpdateSameMD5(t *testing.T) {
   mux.Handle("/testdata/", changeHeaderThenServe(http.FileServer(http.Dir("."))))
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
-	yes, err := db.needUpdate(srv.URL + "/" + testFile)
+	src := &HTTPSource{URL: srv.URL + "/" + testFile}
+	yes, err := src.Check(db.localVersion(src))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -130,7 +135,8 @@ func TestNeedUpdateMD5(t *testing.T) {
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
 	db := &DB{file: testFile}
-	yes, err := db.needUpdate(srv.URL + "/" + testFile)
+	src := &HTTPSource{URL: srv.URL + "/" + testFile}
+	yes, err := src.Check(db.localVersion(src))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -152,7 +158,8 @@ func TestNeedUpdate(t *testing.T) {
 	defer f.Close()
 	defer os.Remove(file)
 	db := &DB{file: file}
-	yes, err := db.needUpdate(srv.URL + "/" + testFile)
+	src := &HTTPSource{URL: srv.URL + "/" + testFile}
+	yes, err := src.Check(db.localVersion(src))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -176,6 +183,73 @@ func TestOpenFile(t *testing.T) {
 	db.Date() // Test this?
 }
 
+func TestOpenFileMemoryMap(t *testing.T) {
+	db, err := Open(testFile, MemoryMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mapped := db.cache.mappedFile(testFile)
+	defer os.Remove(mappedInfoFile(mapped))
+	defer os.Remove(mapped)
+	if _, err = os.Stat(mapped); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(mapped) == filepath.Dir(testFile) {
+		t.Fatal("Decompressed next to the database file:", mapped)
+	}
+	var record DefaultQuery
+	err = db.Lookup(net.ParseIP("8.8.8.8"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+	_, checksum, err := (&DB{}).newReader(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.checksum != checksum {
+		t.Fatalf("Unexpected checksum: want %q, have %q", checksum, db.checksum)
+	}
+}
+
+func TestOpenFileMemoryMapReuse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := []Option{MemoryMap(), Cache(CacheOptions{Dir: dir})}
+	db, err := Open(testFile, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped := db.cache.mappedFile(testFile)
+	before, err := os.Stat(mapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := db.checksum
+	db.Close()
+	db, err = Open(testFile, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	after, err := os.Stat(mapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Fatal("Decompressed an unchanged database file again")
+	}
+	if db.checksum != checksum {
+		t.Fatalf("Unexpected checksum: want %q, have %q", checksum, db.checksum)
+	}
+}
+
 func TestOpenBadFile(t *testing.T) {
 	db, err := Open("db_test.go")
 	if err == nil {
@@ -294,15 +368,17 @@ func TestLookupOnURL(t *testing.T) {
 	mux.Handle("/testdata/", http.FileServer(http.Dir(".")))
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
-	os.Remove(defaultDB) // In case it exists.
-	db, err := OpenURL(srv.URL+"/"+testFile, time.Hour, time.Minute)
+	url := srv.URL + "/" + testFile
+	dbfile := (&CacheOptions{}).cacheFile(&HTTPSource{URL: url}, "")
+	os.Remove(dbfile) // In case it exists.
+	db, err := OpenURL(url, time.Hour, time.Minute)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer db.Close()
 	select {
 	case file := <-db.NotifyOpen():
-		if file != defaultDB {
+		if file != dbfile {
 			t.Fatal("Unexpected db file:", file)
 		}
 	case err := <-db.NotifyError():
@@ -329,3 +405,46 @@ func TestLookuUnavailable(t *testing.T) {
 		t.Fatal("Unexpected lookup worked")
 	}
 }
+
+func TestWaitReady(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/db.gz", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		http.ServeFile(w, r, testFile)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := OpenURL(srv.URL+"/db.gz", time.Hour, time.Minute, Cache(CacheOptions{Dir: dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var record DefaultQuery
+	err = db.LookupContext(ctx, net.ParseIP("8.8.8.8"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+}
+
+func TestWaitReadyUnavailable(t *testing.T) {
+	db := newPendingDB()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := db.WaitReady(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Unexpected error:", err)
+	}
+	db.Close()
+	if err := db.WaitReady(context.Background()); err != ErrUnavailable {
+		t.Fatal("Unexpected error:", err)
+	}
+}
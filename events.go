@@ -0,0 +1,202 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of an Event.
+type EventType int
+
+// Types of events. See Event for the fields set by each type.
+const (
+	EventDownloadStarted  EventType = iota + 1 // Download of a new version started.
+	EventDownloadFinished                      // Download finished, maybe with an error.
+	EventReload                                // Database file was loaded.
+	EventValidationFailed                      // New database was rejected by Validate.
+	EventRollback                              // Database was rolled back.
+	EventError                                 // Error, as sent to NotifyError.
+	EventInfo                                  // Informational message, as sent to NotifyInfo.
+	EventClose                                 // DB was closed, the last event.
+	EventOverflow                              // Events were dropped, see Subscription.
+)
+
+var eventTypeNames = map[EventType]string{
+	EventDownloadStarted:  "download_started",
+	EventDownloadFinished: "download_finished",
+	EventReload:           "reload",
+	EventValidationFailed: "validation_failed",
+	EventRollback:         "rollback",
+	EventError:            "error",
+	EventInfo:             "info",
+	EventClose:            "close",
+	EventOverflow:         "overflow",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Event is an event of a DB, delivered to subscribers. See Subscribe.
+type Event struct {
+	Type EventType
+	Time time.Time
+	File string // Database file name.
+
+	// Bytes is the size of the downloaded file, and Checksum its hex
+	// encoded SHA-256 digest, for EventDownloadFinished. For
+	// EventReload, Checksum is the hex encoded MD5 digest of the
+	// database loaded, as in the X-Database-MD5 header.
+	Bytes    int64
+	Checksum string
+
+	Err     error  // Error of EventDownloadFinished, EventValidationFailed and EventError.
+	Message string // Message of EventInfo.
+}
+
+// maxQueuedEvents is the size of the queue of events of subscriptions.
+const maxQueuedEvents = 1024
+
+// Subscription is a stream of the events of a DB. Each subscription
+// has its own queue of events, so slow subscribers don't steal events
+// from others, as with the Notify channels. When the queue is full,
+// the events are dropped and the subscriber gets an EventOverflow in
+// their place. The EventClose is never dropped.
+type Subscription struct {
+	db   *DB
+	out  chan Event
+	quit chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []Event
+	closed bool // No more events are queued.
+}
+
+// Subscribe returns a new subscription to the events of the DB. The
+// events are delivered in order, until the EventClose of the DB or
+// the subscription is closed.
+func (db *DB) Subscribe() *Subscription {
+	s := &Subscription{
+		db:   db,
+		out:  make(chan Event),
+		quit: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.run()
+	db.subsMu.Lock()
+	defer db.subsMu.Unlock()
+	if db.subsClosed {
+		s.push(Event{Type: EventClose, Time: time.Now(), File: db.file})
+		s.finish()
+		return s
+	}
+	if db.subs == nil {
+		db.subs = make(map[*Subscription]struct{})
+	}
+	db.subs[s] = struct{}{}
+	return s
+}
+
+// Events returns the channel of events of the subscription. It's
+// closed after the EventClose of the DB, or when the subscription
+// is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.out
+}
+
+// Close closes the subscription, dropping events not yet received.
+func (s *Subscription) Close() {
+	s.db.subsMu.Lock()
+	delete(s.db.subs, s)
+	s.db.subsMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+	s.closed = true
+	s.cond.Signal()
+}
+
+func (s *Subscription) push(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	switch n := len(s.queue); {
+	case ev.Type == EventClose || n < maxQueuedEvents-1:
+	case n == maxQueuedEvents-1:
+		ev = Event{Type: EventOverflow, Time: ev.Time, File: ev.File}
+	default:
+		return
+	}
+	s.queue = append(s.queue, ev)
+	s.cond.Signal()
+}
+
+// finish stops queueing events, and closes the channel once the queued
+// events are received.
+func (s *Subscription) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Signal()
+}
+
+// run delivers the queued events to the channel of the subscription.
+func (s *Subscription) run() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		ev := s.queue[0]
+		s.queue[0] = Event{}
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.out <- ev:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// publish delivers the event to all subscribers of the DB.
+func (db *DB) publish(ev Event) {
+	ev.Time = time.Now()
+	if ev.File == "" {
+		ev.File = db.file
+	}
+	db.subsMu.Lock()
+	defer db.subsMu.Unlock()
+	if db.subsClosed {
+		return
+	}
+	for s := range db.subs {
+		s.push(ev)
+	}
+	if ev.Type == EventClose {
+		for s := range db.subs {
+			s.finish()
+		}
+		db.subs = nil
+		db.subsClosed = true
+	}
+}
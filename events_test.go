@@ -0,0 +1,127 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func eventTypes(events []Event) []EventType {
+	types := make([]EventType, len(events))
+	for i, ev := range events {
+		types[i] = ev.Type
+	}
+	return types
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, testFile)
+	}))
+	defer srv.Close()
+	db, dir := newRollbackDB(t)
+	defer os.RemoveAll(dir)
+
+	// Subscribers receive all events, even if they don't read them
+	// until the DB is closed.
+	subs := []*Subscription{db.Subscribe(), db.Subscribe()}
+	if err := db.runUpdate(&HTTPSource{URL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	db.sendInfo("one")
+	db.sendInfo("two")
+	db.Close()
+
+	want := []EventType{
+		EventDownloadStarted,
+		EventDownloadFinished,
+		EventReload,
+		EventInfo,
+		EventInfo,
+		EventClose,
+	}
+	for i, sub := range subs {
+		var events []Event
+		for ev := range sub.Events() {
+			events = append(events, ev)
+		}
+		if types := eventTypes(events); !reflect.DeepEqual(types, want) {
+			t.Fatalf("Subscriber %d: unexpected events: want %v, have %v", i, want, types)
+		}
+		stat, err := os.Stat(testFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev := events[1]; ev.Bytes != stat.Size() || len(ev.Checksum) != 64 || ev.Err != nil {
+			t.Fatalf("Subscriber %d: unexpected download event: %+v", i, ev)
+		}
+		if ev := events[2]; ev.File != db.file || ev.Checksum == "" {
+			t.Fatalf("Subscriber %d: unexpected reload event: %+v", i, ev)
+		}
+		if events[4].Message != "two" {
+			t.Fatalf("Subscriber %d: unexpected message: %q", i, events[4].Message)
+		}
+	}
+
+	// Subscriptions of closed DBs only get EventClose.
+	var types []EventType
+	for ev := range db.Subscribe().Events() {
+		types = append(types, ev.Type)
+	}
+	if want := []EventType{EventClose}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("Unexpected events: want %v, have %v", want, types)
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	db := newPendingDB()
+	defer db.Close()
+	sub := db.Subscribe()
+	db.sendInfo("dropped")
+	sub.Close()
+	db.sendInfo("not queued")
+	for ev := range sub.Events() {
+		if ev.Message != "dropped" {
+			t.Fatalf("Unexpected event: %+v", ev)
+		}
+	}
+	if len(db.subs) != 0 {
+		t.Fatal("Subscription was not removed")
+	}
+}
+
+func TestSubscriptionOverflow(t *testing.T) {
+	db := newPendingDB()
+	sub := db.Subscribe()
+	for i := 0; i < maxQueuedEvents+10; i++ {
+		db.sendInfo("info")
+	}
+	db.Close()
+	var events []Event
+	for ev := range sub.Events() {
+		events = append(events, ev)
+	}
+	// The subscriber may have received an event before the queue was full.
+	n := len(events)
+	if n < maxQueuedEvents+1 || n > maxQueuedEvents+2 {
+		t.Fatalf("Unexpected number of events: %d", n)
+	}
+	if events[n-2].Type != EventOverflow || events[n-1].Type != EventClose {
+		t.Fatalf("Unexpected events: %v", eventTypes(events[n-2:]))
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	if s := EventValidationFailed.String(); s != "validation_failed" {
+		t.Fatalf("Unexpected name: %q", s)
+	}
+	if s := EventType(0).String(); s != "unknown" {
+		t.Fatalf("Unexpected name: %q", s)
+	}
+}
@@ -5,6 +5,7 @@
 package freegeoip
 
 import (
+	"context"
 	"log"
 	"net"
 	"time"
@@ -32,14 +33,11 @@ func ExampleOpenURL() {
 		log.Fatal(err)
 	}
 	defer db.Close()
-	select {
-	case <-db.NotifyOpen():
-		// Wait for the db to be downloaded.
-	case err := <-db.NotifyError():
-		log.Fatal(err)
-	}
+	// Wait up to a minute for the db to be downloaded.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 	var result customQuery
-	err = db.Lookup(net.ParseIP("8.8.8.8"), &result)
+	err = db.LookupContext(ctx, net.ParseIP("8.8.8.8"), &result)
 	if err != nil {
 		log.Fatal(err)
 	}
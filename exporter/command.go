@@ -0,0 +1,64 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package exporter implements the export command of the freegeoip
+// server, which writes the networks of databases as CSV or NDJSON.
+package exporter
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"os"
+
+	"github.com/fiorix/freegeoip"
+	"github.com/fiorix/freegeoip/apiserver"
+)
+
+// Run is the entrypoint for the export command of the freegeoip
+// server, which writes all networks in a database to stdout.
+func Run(args []string) error {
+	w := bufio.NewWriter(os.Stdout)
+	if err := export(w, args); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// export writes the networks of the database set in the command line
+// arguments to w, one per line, as CSV or NDJSON.
+func export(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbfile := fs.String("db", "", "IP database file to export (required)")
+	format := fs.String("format", "csv", "Output format: csv or ndjson")
+	within := fs.String("within", "", "Only export networks within this CIDR, e.g. 10.0.0.0/8")
+	lang := fs.String("lang", "en", "Language of names, as in the Accept-Language header")
+	fallback := fs.String("lang-fallback", "", "Comma separated fallback languages of names, as in -lang-fallback of the server")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dbfile == "" {
+		return errors.New("missing database file, set with -db")
+	}
+	o := &apiserver.ExportOptions{
+		Format:       *format,
+		Lang:         *lang,
+		LangFallback: *fallback,
+	}
+	if *within != "" {
+		_, network, err := net.ParseCIDR(*within)
+		if err != nil {
+			return err
+		}
+		o.Within = network
+	}
+	db, err := freegeoip.Open(*dbfile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return apiserver.Export(w, db, o)
+}
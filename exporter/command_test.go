@@ -0,0 +1,62 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var testFile = "../testdata/db.gz"
+
+func TestExportCSV(t *testing.T) {
+	var b bytes.Buffer
+	err := export(&b, []string{"-db", testFile, "-within", "200.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "network,ip,country_code,country_name,region_code,region_name,city,zip_code,time_zone,latitude,longitude,metro_code\n" +
+		"200.1.2.0/24,200.1.2.0,VE,Venezuela,A,Distrito Federal,Caracas,1010,America/Caracas,10.5000,-66.9168,0\n"
+	if b.String() != want {
+		t.Fatalf("Unexpected export:\nwant %q\nhave %q", want, b.String())
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := export(&b, []string{"-db", testFile, "-format", "ndjson"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Unexpected number of networks: %d\n%s", len(lines), b.String())
+	}
+	var rec struct {
+		Network     string `json:"network"`
+		IP          string `json:"ip"`
+		CountryCode string `json:"country_code"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Network != "1.0.0.0/24" || rec.IP != "1.0.0.0" || rec.CountryCode != "AU" {
+		t.Fatalf("Unexpected record: %+v", rec)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	for i, args := range [][]string{
+		{},
+		{"-db", testFile, "-format", "xml"},
+		{"-db", testFile, "-within", "bogus"},
+		{"-db", "does-not-exist"},
+	} {
+		if err := export(&bytes.Buffer{}, args); err == nil {
+			t.Errorf("Test %d: unexpected export with %q", i, args)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnknownFormat is returned when a database file is neither a
+// MaxMind database, nor a gzip or tar archive containing one.
+var ErrUnknownFormat = errors.New("unknown database file format")
+
+// Magic numbers used to detect the format of database files.
+var (
+	gzipMagic      = []byte{0x1f, 0x8b}
+	tarMagic       = []byte("ustar")
+	metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+)
+
+// tarMagicOffset is the offset of the magic number in a tar header.
+const tarMagicOffset = 257
+
+// dbFormat is the format of a database file.
+type dbFormat int
+
+const (
+	formatMMDB dbFormat = iota // Uncompressed MaxMind DB file.
+	formatGzip                 // Gzip compressed file, e.g. .mmdb.gz.
+	formatTar                  // Tar archive, e.g. the inner .tar of .tar.gz.
+)
+
+func (f dbFormat) String() string {
+	switch f {
+	case formatGzip:
+		return "gzip"
+	case formatTar:
+		return "tar"
+	default:
+		return "mmdb"
+	}
+}
+
+// detectFormat detects the format of a database file from the magic
+// numbers at the beginning of its contents. The given reader is not
+// consumed. Anything that is not a gzip or tar file is reported as a
+// MaxMind DB file, to be validated once read.
+func detectFormat(r *bufio.Reader) (dbFormat, error) {
+	b, err := r.Peek(tarMagicOffset + len(tarMagic))
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		return formatGzip, nil
+	case len(b) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(b[tarMagicOffset:], tarMagic):
+		return formatTar, nil
+	}
+	return formatMMDB, nil
+}
+
+// unpack returns a reader of the MaxMind DB file contained in r. Gzip
+// files are decompressed, and the .mmdb member of tar archives (e.g.
+// GeoLite2-City_20171003/GeoLite2-City.mmdb) is extracted, so r can
+// be a plain .mmdb, a .mmdb.gz, or a .tar.gz file. Only one layer of
+// gzip and one of tar are unpacked.
+func unpack(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	format, err := detectFormat(br)
+	if err != nil {
+		return nil, err
+	}
+	if format == formatGzip {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gzr)
+		if format, err = detectFormat(br); err != nil {
+			return nil, err
+		}
+		if format == formatGzip {
+			return nil, fmt.Errorf("%s: nested gzip file", ErrUnknownFormat)
+		}
+	}
+	if format == formatTar {
+		return untar(br)
+	}
+	return br, nil
+}
+
+// untar returns a reader of the first .mmdb file in the tar archive r.
+func untar(r io.Reader) (io.Reader, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: no .mmdb file in tar archive", ErrUnknownFormat)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if strings.HasSuffix(path.Base(hdr.Name), ".mmdb") {
+			return tr, nil
+		}
+	}
+}
+
+// readDatabase reads all contents of the MaxMind DB file contained in
+// r, which may be compressed or archived. See unpack for details.
+func readDatabase(r io.Reader) ([]byte, error) {
+	mmdb, err := unpack(r)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if _, err = b.ReadFrom(mmdb); err != nil {
+		return nil, err
+	}
+	if bytes.LastIndex(b.Bytes(), metadataMarker) == -1 {
+		return nil, ErrUnknownFormat
+	}
+	return b.Bytes(), nil
+}
+
+// extractFile writes the MaxMind DB file contained in r to the file
+// dst, and to h. The file is written to a temporary file first, then
+// renamed to dst, so that a previous version of dst that might be
+// memory-mapped is not modified.
+func extractFile(dst string, r io.Reader, h hash.Hash) error {
+	mmdb, err := unpack(r)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(dst), "_"+filepath.Base(dst))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // Fails after renaming, that's fine.
+	_, err = io.Copy(io.MultiWriter(f, h), mmdb)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dst)
+}
@@ -0,0 +1,162 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMMDB returns the uncompressed contents of the test database.
+func testMMDB(t *testing.T) []byte {
+	f, err := os.Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(gzr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testTar returns a tar archive laid out like the ones distributed by
+// MaxMind, with the database in a dated directory.
+func testTar(t *testing.T, mmdb []byte) []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	files := []struct {
+		Name string
+		Data []byte
+	}{
+		{"GeoLite2-City_20171003/COPYRIGHT.txt", []byte("copyright")},
+		{"GeoLite2-City_20171003/GeoLite2-City.mmdb", mmdb},
+		{"GeoLite2-City_20171003/LICENSE.txt", []byte("license")},
+	}
+	err := tw.WriteHeader(&tar.Header{
+		Name:     "GeoLite2-City_20171003/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     f.Name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(f.Data)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write(f.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func testGzip(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	gzw := gzip.NewWriter(&b)
+	if _, err := gzw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDetectFormat(t *testing.T) {
+	mmdb := testMMDB(t)
+	tp := []struct {
+		Data   []byte
+		Format dbFormat
+	}{
+		{mmdb, formatMMDB},
+		{testGzip(t, mmdb), formatGzip},
+		{testTar(t, mmdb), formatTar},
+		{testGzip(t, testTar(t, mmdb)), formatGzip},
+		{[]byte{}, formatMMDB},
+	}
+	for i, p := range tp {
+		format, err := detectFormat(bufio.NewReader(bytes.NewReader(p.Data)))
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if format != p.Format {
+			t.Fatalf("Test %d: want %s, have %s", i, p.Format, format)
+		}
+	}
+}
+
+func TestOpenFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mmdb := testMMDB(t)
+	tp := map[string][]byte{
+		"GeoLite2-City.mmdb":    mmdb,
+		"GeoLite2-City.mmdb.gz": testGzip(t, mmdb),
+		"GeoLite2-City.tar":     testTar(t, mmdb),
+		"GeoLite2-City.tar.gz":  testGzip(t, testTar(t, mmdb)),
+	}
+	for name, data := range tp {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, opts := range [][]Option{nil, {MemoryMap(), Cache(CacheOptions{Dir: dir})}} {
+			db, err := Open(file, opts...)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			var record DefaultQuery
+			err = db.Lookup(net.ParseIP("8.8.8.8"), &record)
+			db.Close()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if record.Country.ISOCode != "US" {
+				t.Fatalf("%s: unexpected ISO code: %q", name, record.Country.ISOCode)
+			}
+		}
+	}
+}
+
+func TestReadDatabaseUnknownFormat(t *testing.T) {
+	tp := [][]byte{
+		[]byte("hello world"),
+		testGzip(t, []byte("hello world")),
+		testGzip(t, testTar(t, nil)[:1024]),
+		testGzip(t, testGzip(t, testMMDB(t))),
+	}
+	for i, data := range tp {
+		_, err := readDatabase(bytes.NewReader(data))
+		if err == nil {
+			t.Fatalf("Test %d: unexpected database was read", i)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+)
+
+// Run is the entrypoint for the import command of the freegeoip
+// server, which converts the datasets of other providers to MaxMind DB
+// files that can be served with -db.
+func Run(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "Format of the dataset: ip2location or dbip (required). The time_zone column of IP2Location DB11 is skipped, as it has UTC offsets rather than IANA time zones")
+	in := fs.String("in", "", "CSV file of the dataset, optionally gzipped (.gz) (required)")
+	out := fs.String("out", "", "MaxMind DB file to write, gzipped if it ends with .gz (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" || *in == "" || *out == "" {
+		return errors.New("missing arguments, set -format, -in and -out")
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(*in, ".gz") {
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+	// Write to a temporary file first, so servers watching the output
+	// file never load a partial database.
+	tmp := *out + ".tmp"
+	if err = importFile(tmp, r, *format, strings.HasSuffix(*out, ".gz")); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, *out)
+}
+
+func importFile(name string, r io.Reader, format string, gz bool) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	w := io.Writer(bw)
+	var gzw *gzip.Writer
+	if gz {
+		gzw = gzip.NewWriter(bw)
+		w = gzw
+	}
+	if err = Import(w, r, format); err != nil {
+		return err
+	}
+	if gzw != nil {
+		if err = gzw.Close(); err != nil {
+			return err
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,57 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fiorix/freegeoip"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "dbip-city-lite.csv")
+	out := filepath.Join(dir, "dbip.mmdb.gz")
+	csv := "8.8.8.0,8.8.8.255,NA,US,California,\"Mountain View\",37.386,-122.0838\n"
+	if err = ioutil.WriteFile(in, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = Run([]string{"-format", "dbip", "-in", in, "-out", out}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := freegeoip.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var q freegeoip.DefaultQuery
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Country.ISOCode != "US" || len(q.Region) != 1 || q.Region[0].Names["en"] != "California" ||
+		q.City.Names["en"] != "Mountain View" || q.Location.Latitude != 37.386 {
+		t.Fatalf("Unexpected record: %+v", q)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for i, args := range [][]string{
+		{},
+		{"-format", "dbip", "-in", "does-not-exist.csv", "-out", "db.mmdb"},
+		{"-format", "bogus", "-in", "../testdata/db.gz", "-out", filepath.Join(os.TempDir(), "freegeoip-test.mmdb")},
+	} {
+		if err := Run(args); err == nil {
+			t.Errorf("Test %d: unexpected import", i)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+)
+
+// ReadDBIP reads the CSV file of a DB-IP Lite dataset, e.g.
+// dbip-country-lite-2018-01.csv or dbip-city-lite-2018-01.csv. The
+// layout of the file is detected by its number of columns, and ranges
+// without a country (ZZ) are skipped.
+//
+// DB-IP Lite datasets have no names of countries.
+func ReadDBIP(r io.Reader, fn func(first, last net.IP, p *Place) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p := &Place{}
+		switch len(row) {
+		case 3:
+			// ip_start,ip_end,country
+			p.Country = row[2]
+		case 8:
+			// ip_start,ip_end,continent,country,stateprov,city,latitude,longitude
+			p.Continent, p.Country, p.Region, p.City = row[2], row[3], row[4], row[5]
+			if p.Latitude, err = parseCoordinate(row[6]); err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+			if p.Longitude, err = parseCoordinate(row[7]); err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+		default:
+			return fmt.Errorf("line %d: unsupported DB-IP layout with %d columns", line, len(row))
+		}
+		if p.Country == "" || p.Country == "ZZ" {
+			continue
+		}
+		first, last := net.ParseIP(row[0]), net.ParseIP(row[1])
+		if first == nil || last == nil {
+			return fmt.Errorf("line %d: invalid range: %s-%s", line, row[0], row[1])
+		}
+		if err = fn(first, last, p); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadDBIP(t *testing.T) {
+	csv := `1.0.0.0,1.0.0.255,OC,AU,Queensland,"South Brisbane",-27.4748,153.017
+1.0.1.0,1.0.3.255,AS,ZZ,,,,
+2a02:f000::,2a02:f0ff:ffff:ffff:ffff:ffff:ffff:ffff,EU,DE,Berlin,Berlin,52.5244,13.4105
+`
+	var ranges []string
+	var places []*Place
+	err := ReadDBIP(strings.NewReader(csv), func(first, last net.IP, p *Place) error {
+		ranges = append(ranges, first.String()+"-"+last.String())
+		places = append(places, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1.0.0.0-1.0.0.255", "2a02:f000::-2a02:f0ff:ffff:ffff:ffff:ffff:ffff:ffff"}
+	if strings.Join(ranges, " ") != strings.Join(want, " ") {
+		t.Fatalf("Unexpected ranges: want %q, have %q", want, ranges)
+	}
+	p := places[0]
+	if p.Continent != "OC" || p.Country != "AU" || p.Region != "Queensland" ||
+		p.City != "South Brisbane" || p.Latitude != -27.4748 || p.Longitude != 153.017 {
+		t.Fatalf("Unexpected place: %+v", p)
+	}
+}
+
+func TestReadDBIPCountry(t *testing.T) {
+	csv := "1.0.0.0,1.0.0.255,AU\n"
+	var places []*Place
+	err := ReadDBIP(strings.NewReader(csv), func(first, last net.IP, p *Place) error {
+		places = append(places, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(places) != 1 || places[0].Country != "AU" {
+		t.Fatalf("Unexpected places: %+v", places)
+	}
+}
+
+func TestReadDBIPErrors(t *testing.T) {
+	for i, csv := range []string{
+		"1.0.0.0,1.0.0.255\n",
+		"1.0.0.0,bogus,AU\n",
+	} {
+		err := ReadDBIP(strings.NewReader(csv), func(first, last net.IP, p *Place) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("Test %d: unexpected dataset was read", i)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package importer converts the IP geolocation datasets of other
+// providers to MaxMind DB files, with records laid out as
+// freegeoip.DefaultQuery expects, so they can be served like the
+// databases of MaxMind.
+//
+// Supported datasets are the CSV files of IP2Location LITE (DB1, DB3,
+// DB5, DB9 and DB11, IPv4 or IPv6) and DB-IP Lite (country and city).
+package importer
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// Place is the location of a range of addresses in a dataset. Empty
+// fields are not part of the records.
+type Place struct {
+	Continent   string // Code of the continent, e.g. EU.
+	Country     string // ISO 3166-1 code of the country, e.g. DE.
+	CountryName string
+	Region      string // Name of the region, e.g. Berlin.
+	City        string
+	PostalCode  string
+	TimeZone    string // IANA time zone, e.g. Europe/Berlin. Not in the built-in formats.
+	Latitude    float64
+	Longitude   float64
+}
+
+// continents are the names of continents by code.
+var continents = map[string]string{
+	"AF": "Africa",
+	"AN": "Antarctica",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "North America",
+	"OC": "Oceania",
+	"SA": "South America",
+}
+
+// Record returns the record of the place, as in GeoIP2 databases, with
+// names in English.
+func (p *Place) Record() map[string]interface{} {
+	rec := make(map[string]interface{})
+	names := func(name string) map[string]interface{} {
+		return map[string]interface{}{"en": name}
+	}
+	if p.Continent != "" {
+		continent := map[string]interface{}{"code": p.Continent}
+		if name, ok := continents[p.Continent]; ok {
+			continent["names"] = names(name)
+		}
+		rec["continent"] = continent
+	}
+	if p.Country != "" || p.CountryName != "" {
+		country := make(map[string]interface{})
+		if p.Country != "" {
+			country["iso_code"] = p.Country
+		}
+		if p.CountryName != "" {
+			country["names"] = names(p.CountryName)
+		}
+		rec["country"] = country
+	}
+	if p.Region != "" {
+		rec["subdivisions"] = []interface{}{
+			map[string]interface{}{"names": names(p.Region)},
+		}
+	}
+	if p.City != "" {
+		rec["city"] = map[string]interface{}{"names": names(p.City)}
+	}
+	if p.PostalCode != "" {
+		rec["postal"] = map[string]interface{}{"code": p.PostalCode}
+	}
+	location := make(map[string]interface{})
+	if p.Latitude != 0 || p.Longitude != 0 {
+		location["latitude"] = p.Latitude
+		location["longitude"] = p.Longitude
+	}
+	if p.TimeZone != "" {
+		location["time_zone"] = p.TimeZone
+	}
+	if len(location) > 0 {
+		rec["location"] = location
+	}
+	return rec
+}
+
+// Format is the format of a dataset.
+type Format struct {
+	Name         string // Name of the format, e.g. ip2location.
+	DatabaseType string // Type of the databases, e.g. IP2Location-LITE.
+
+	// Read reads the dataset, calling fn for each range of addresses
+	// with a location.
+	Read func(r io.Reader, fn func(first, last net.IP, p *Place) error) error
+}
+
+// Formats are the supported formats of datasets.
+var Formats = []*Format{
+	{Name: "ip2location", DatabaseType: "IP2Location-LITE", Read: ReadIP2Location},
+	{Name: "dbip", DatabaseType: "DBIP-Lite", Read: ReadDBIP},
+}
+
+// Import reads the dataset in the named format from r, and writes it
+// to w as a MaxMind DB file.
+func Import(w io.Writer, r io.Reader, format string) error {
+	var f *Format
+	for _, ff := range Formats {
+		if ff.Name == format {
+			f = ff
+			break
+		}
+	}
+	if f == nil {
+		return fmt.Errorf("unsupported format: %q", format)
+	}
+	mw := NewWriter(f.DatabaseType)
+	mw.Description = map[string]string{"en": "Imported from " + f.Name + " dataset by freegeoip"}
+	err := f.Read(r, func(first, last net.IP, p *Place) error {
+		return mw.InsertRange(first, last, p.Record())
+	})
+	if err != nil {
+		return err
+	}
+	_, err = mw.WriteTo(w)
+	return err
+}
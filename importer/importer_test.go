@@ -0,0 +1,75 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fiorix/freegeoip"
+)
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var b bytes.Buffer
+	err = Import(&b, strings.NewReader(testIP2LocationCSV), "ip2location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "db.mmdb")
+	if err = ioutil.WriteFile(file, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := freegeoip.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var q freegeoip.DefaultQuery
+	if err = db.Lookup(net.ParseIP("1.0.4.1"), &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Country.ISOCode != "AU" || q.Country.Names["en"] != "Australia" ||
+		len(q.Region) != 1 || q.Region[0].Names["en"] != "Victoria" ||
+		q.City.Names["en"] != "Melbourne" || q.Postal.Code != "3000" ||
+		q.Location.Latitude != -37.814 || q.Location.Longitude != 144.96332 {
+		t.Fatalf("Unexpected record: %+v", q)
+	}
+	md, err := db.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.DatabaseType != "IP2Location-LITE" || md.Languages[0] != "en" {
+		t.Fatalf("Unexpected metadata: %+v", md)
+	}
+}
+
+func TestImportUnsupportedFormat(t *testing.T) {
+	var b bytes.Buffer
+	if err := Import(&b, strings.NewReader(""), "maxmind"); err == nil {
+		t.Fatal("Unexpected import of unsupported format")
+	}
+}
+
+func TestPlaceRecord(t *testing.T) {
+	p := &Place{Continent: "EU", Country: "DE"}
+	rec := p.Record()
+	if len(rec) != 2 {
+		t.Fatalf("Unexpected record: %v", rec)
+	}
+	continent := rec["continent"].(map[string]interface{})
+	if continent["names"].(map[string]interface{})["en"] != "Europe" {
+		t.Fatalf("Unexpected continent: %v", continent)
+	}
+}
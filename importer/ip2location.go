@@ -0,0 +1,103 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+)
+
+// ReadIP2Location reads the CSV file of an IP2Location LITE dataset,
+// e.g. IP2LOCATION-LITE-DB11.CSV or IP2LOCATION-LITE-DB11.IPV6.CSV.
+// The layout of the file is detected by its number of columns, and
+// ranges without a country are skipped.
+//
+// The time_zone column of DB11 is skipped: its time zones are UTC
+// offsets, e.g. -05:00, rather than IANA time zones, so Place.TimeZone
+// is not set.
+func ReadIP2Location(r io.Reader, fn func(first, last net.IP, p *Place) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Columns of DB1, DB3, DB5, DB9 and DB11.
+		switch len(row) {
+		case 4, 6, 8, 9, 10:
+		default:
+			return fmt.Errorf("line %d: unsupported IP2Location layout with %d columns", line, len(row))
+		}
+		for i, v := range row {
+			if v == "-" {
+				row[i] = ""
+			}
+		}
+		if row[2] == "" {
+			continue
+		}
+		first, err := parseIPNumber(row[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		last, err := parseIPNumber(row[1])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		p := &Place{Country: row[2], CountryName: row[3]}
+		if len(row) >= 6 {
+			p.Region, p.City = row[4], row[5]
+		}
+		if len(row) >= 8 {
+			if p.Latitude, err = parseCoordinate(row[6]); err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+			if p.Longitude, err = parseCoordinate(row[7]); err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+		}
+		if len(row) >= 9 {
+			p.PostalCode = row[8]
+		}
+		// row[9] is the time_zone column of DB11, see above.
+		if err = fn(first, last, p); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+}
+
+// parseIPNumber parses the decimal number of an IP address, as in the
+// datasets of IP2Location. Numbers up to 2^32-1 are IPv4 addresses.
+func parseIPNumber(s string) (net.IP, error) {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return nil, fmt.Errorf("invalid IP number: %q", s)
+	}
+	if n.BitLen() <= 32 {
+		ip := make(net.IP, net.IPv4len)
+		b := n.Bytes()
+		copy(ip[net.IPv4len-len(b):], b)
+		return ip, nil
+	}
+	ip := make(net.IP, net.IPv6len)
+	b := n.Bytes()
+	copy(ip[net.IPv6len-len(b):], b)
+	return ip, nil
+}
+
+func parseCoordinate(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,72 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const testIP2LocationCSV = `"0","16777215","-","-","-","-","0.000000","0.000000","-","-"
+"16777216","16777471","AU","Australia","Queensland","Brisbane","-27.467940","153.028090","4000","+10:00"
+"16778240","16779263","AU","Australia","Victoria","Melbourne","-37.814000","144.963320","3000","+10:00"
+`
+
+func TestReadIP2Location(t *testing.T) {
+	var ranges []string
+	var places []*Place
+	err := ReadIP2Location(strings.NewReader(testIP2LocationCSV), func(first, last net.IP, p *Place) error {
+		ranges = append(ranges, first.String()+"-"+last.String())
+		places = append(places, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1.0.0.0-1.0.0.255", "1.0.4.0-1.0.7.255"}
+	if strings.Join(ranges, " ") != strings.Join(want, " ") {
+		t.Fatalf("Unexpected ranges: want %q, have %q", want, ranges)
+	}
+	p := places[0]
+	if p.Country != "AU" || p.CountryName != "Australia" || p.Region != "Queensland" ||
+		p.City != "Brisbane" || p.PostalCode != "4000" || p.TimeZone != "" ||
+		p.Latitude != -27.46794 || p.Longitude != 153.02809 {
+		t.Fatalf("Unexpected place: %+v", p)
+	}
+}
+
+func TestReadIP2LocationIPv6(t *testing.T) {
+	csv := `"281470698520576","281470698520831","AU","Australia"
+"58569105395146355079250494851844669440","58569105395146355079250494851844669441","JP","Japan"
+`
+	var ranges []string
+	err := ReadIP2Location(strings.NewReader(csv), func(first, last net.IP, p *Place) error {
+		ranges = append(ranges, first.String()+"-"+last.String()+"="+p.Country)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1.0.0.0-1.0.0.255=AU", "2c0f:ffd8::-2c0f:ffd8::1=JP"}
+	if strings.Join(ranges, " ") != strings.Join(want, " ") {
+		t.Fatalf("Unexpected ranges: want %q, have %q", want, ranges)
+	}
+}
+
+func TestReadIP2LocationErrors(t *testing.T) {
+	for i, csv := range []string{
+		`"16777216","16777471","AU","Australia","Queensland"`,
+		`"one","16777471","AU","Australia"`,
+		`"16777216","16777471","AU","Australia","Queensland","Brisbane","south","153.028090"`,
+	} {
+		err := ReadIP2Location(strings.NewReader(csv), func(first, last net.IP, p *Place) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("Test %d: unexpected dataset was read", i)
+		}
+	}
+}
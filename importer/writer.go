@@ -0,0 +1,381 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"net"
+	"sort"
+	"time"
+)
+
+// Writer writes MaxMind DB files. Records are maps, with the types of
+// values supported by the format, e.g. string, float64, uint32 and
+// nested maps and slices.
+//
+// Databases are IPv6, with IPv4 networks in the ::/96 subtree, as in
+// the databases of MaxMind.
+type Writer struct {
+	DatabaseType string            // e.g. IP2Location-LITE.
+	Description  map[string]string // By language.
+	Languages    []string          // Languages of names in records.
+	BuildTime    time.Time         // Defaults to the time of WriteTo.
+
+	root    node
+	data    bytes.Buffer
+	offsets map[string]uint32 // Offsets of records by encoding.
+}
+
+// node is a node of the search tree. Leaf nodes are records of the
+// data section.
+type node struct {
+	child [2]*node
+	leaf  bool
+	data  uint32 // Offset of the record in the data section.
+	num   uint32 // Number of the node in the search tree.
+}
+
+// NewWriter creates and initializes a new Writer.
+func NewWriter(databaseType string) *Writer {
+	return &Writer{
+		DatabaseType: databaseType,
+		Description:  map[string]string{"en": databaseType},
+		Languages:    []string{"en"},
+		offsets:      make(map[string]uint32),
+	}
+}
+
+// InsertRange inserts the record of the addresses from first to last,
+// inclusive. IPv4 addresses, including IPv4-mapped IPv6 addresses, are
+// inserted as IPv4. Other IPv6 addresses of ::/96, where IPv4 networks
+// are, can't be inserted. Records of overlapping ranges replace the
+// record of the previous ranges.
+func (w *Writer) InsertRange(first, last net.IP, record map[string]interface{}) error {
+	a, b := treeAddr(first), treeAddr(last)
+	if first == nil || last == nil || a.isV4() != b.isV4() || b.less(a) {
+		return fmt.Errorf("invalid range: %s-%s", first, last)
+	}
+	if isV4Compatible(first) || isV4Compatible(last) {
+		return fmt.Errorf("invalid range: %s-%s is in ::/96, the networks of IPv4", first, last)
+	}
+	off, err := w.record(record)
+	if err != nil {
+		return err
+	}
+	for {
+		// Insert the largest network that starts at a and ends
+		// before b.
+		n := a.trailingZeros()
+		for n > 0 && b.less(a.or(mask(n))) {
+			n--
+		}
+		if n == 128 {
+			return fmt.Errorf("invalid range: %s-%s covers all addresses", first, last)
+		}
+		w.insert(a, 128-n, off)
+		end := a.or(mask(n))
+		if end == b {
+			return nil
+		}
+		a = end.next()
+	}
+}
+
+// Insert inserts the record of the network.
+func (w *Writer) Insert(network *net.IPNet, record map[string]interface{}) error {
+	first := network.IP.Mask(network.Mask)
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^network.Mask[i]
+	}
+	return w.InsertRange(first, last, record)
+}
+
+// record returns the offset of the record in the data section, adding
+// it unless an identical record was added before.
+func (w *Writer) record(record map[string]interface{}) (uint32, error) {
+	var b bytes.Buffer
+	if err := encode(&b, record); err != nil {
+		return 0, err
+	}
+	if off, ok := w.offsets[b.String()]; ok {
+		return off, nil
+	}
+	if w.data.Len()+b.Len() > math.MaxUint32/2 {
+		return 0, fmt.Errorf("data section is too large")
+	}
+	off := uint32(w.data.Len())
+	w.data.Write(b.Bytes())
+	w.offsets[b.String()] = off
+	return off, nil
+}
+
+// insert inserts the network of the given prefix length at addr in
+// the search tree, with the record at the data offset.
+func (w *Writer) insert(addr uint128, prefix int, data uint32) {
+	n := &w.root
+	for i := 0; i < prefix; i++ {
+		bit := addr.bit(i)
+		if i == prefix-1 {
+			n.child[bit] = &node{leaf: true, data: data}
+			return
+		}
+		c := n.child[bit]
+		switch {
+		case c == nil:
+			c = &node{}
+		case c.leaf:
+			// Split the network of the record, to replace part of it.
+			c = &node{child: [2]*node{c, c}}
+		}
+		n.child[bit] = c
+		n = c
+	}
+}
+
+// WriteTo writes the database to out.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	var nodes []*node
+	var number func(n *node)
+	number = func(n *node) {
+		n.num = uint32(len(nodes))
+		nodes = append(nodes, n)
+		for _, c := range n.child {
+			if c != nil && !c.leaf {
+				number(c)
+			}
+		}
+	}
+	number(&w.root)
+	count := uint64(len(nodes))
+	recordSize := 24
+	if max := count + 16 + uint64(w.data.Len()); max >= 1<<32 {
+		return 0, fmt.Errorf("database is too large")
+	} else if max >= 1<<24 {
+		recordSize = 32
+	}
+	var buf bytes.Buffer
+	rec := make([]byte, 4)
+	for _, n := range nodes {
+		for _, c := range n.child {
+			v := uint32(count)
+			switch {
+			case c == nil:
+			case c.leaf:
+				v = uint32(count) + 16 + c.data
+			default:
+				v = c.num
+			}
+			binary.BigEndian.PutUint32(rec, v)
+			buf.Write(rec[4-recordSize/8:])
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(w.data.Bytes())
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	buildTime := w.BuildTime
+	if buildTime.IsZero() {
+		buildTime = time.Now()
+	}
+	languages := make([]interface{}, len(w.Languages))
+	for i, lang := range w.Languages {
+		languages[i] = lang
+	}
+	err := encode(&buf, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(buildTime.Unix()),
+		"database_type":               w.DatabaseType,
+		"description":                 w.Description,
+		"ip_version":                  uint16(6),
+		"languages":                   languages,
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(recordSize),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(out)
+}
+
+// Types of the data section of MaxMind DB files.
+const (
+	typeString  = 2
+	typeDouble  = 3
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeUint64  = 9
+	typeArray   = 11
+	typeBoolean = 14
+)
+
+// encode encodes the value as in the data section of MaxMind DB files.
+func encode(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		writeControl(b, typeString, len(v))
+		b.WriteString(v)
+	case float64:
+		writeControl(b, typeDouble, 8)
+		binary.Write(b, binary.BigEndian, v)
+	case uint16:
+		writeUint(b, typeUint16, uint64(v))
+	case uint32:
+		writeUint(b, typeUint32, uint64(v))
+	case uint64:
+		writeUint(b, typeUint64, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeControl(b, typeBoolean, size)
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return encode(b, m)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeControl(b, typeMap, len(keys))
+		for _, k := range keys {
+			encode(b, k)
+			if err := encode(b, v[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		writeControl(b, typeArray, len(v))
+		for _, e := range v {
+			if err := encode(b, e); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type of record value: %T", v)
+	}
+	return nil
+}
+
+// writeUint writes the unsigned integer in as few bytes as possible.
+func writeUint(b *bytes.Buffer, typ int, v uint64) {
+	n := (bits.Len64(v) + 7) / 8
+	writeControl(b, typ, n)
+	for i := n - 1; i >= 0; i-- {
+		b.WriteByte(byte(v >> (8 * uint(i))))
+	}
+}
+
+// writeControl writes the control byte of a value of the given type
+// and size, followed by the extended type and size bytes if needed.
+func writeControl(b *bytes.Buffer, typ, size int) {
+	ctrl := byte(typ << 5)
+	if typ > 7 {
+		ctrl = 0
+	}
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		size -= 285
+		sizeBytes = []byte{byte(size >> 8), byte(size)}
+	default:
+		ctrl |= 31
+		size -= 65821
+		sizeBytes = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	}
+	b.WriteByte(ctrl)
+	if typ > 7 {
+		b.WriteByte(byte(typ - 7))
+	}
+	b.Write(sizeBytes)
+}
+
+// uint128 is an address in the search tree of IPv6 databases.
+type uint128 struct {
+	hi, lo uint64
+}
+
+// treeAddr returns the address of the IP in the search tree.
+func treeAddr(ip net.IP) uint128 {
+	if ip4 := ip.To4(); ip4 != nil {
+		return uint128{lo: uint64(binary.BigEndian.Uint32(ip4))}
+	}
+	if len(ip) != net.IPv6len {
+		return uint128{}
+	}
+	return uint128{
+		hi: binary.BigEndian.Uint64(ip[:8]),
+		lo: binary.BigEndian.Uint64(ip[8:]),
+	}
+}
+
+// isV4Compatible returns whether ip is an IPv6 address of ::/96 that
+// is not IPv4-mapped, e.g. ::1, and would be in the search tree of
+// IPv4 addresses.
+func isV4Compatible(ip net.IP) bool {
+	return len(ip) == net.IPv6len && ip.To4() == nil && treeAddr(ip).isV4()
+}
+
+// mask returns the address with the n lower bits set.
+func mask(n int) uint128 {
+	if n >= 64 {
+		return uint128{hi: 1<<uint(n-64) - 1, lo: math.MaxUint64}
+	}
+	return uint128{lo: 1<<uint(n) - 1}
+}
+
+func (u uint128) isV4() bool {
+	return u.hi == 0 && u.lo <= math.MaxUint32
+}
+
+func (u uint128) less(v uint128) bool {
+	return u.hi < v.hi || (u.hi == v.hi && u.lo < v.lo)
+}
+
+func (u uint128) or(v uint128) uint128 {
+	return uint128{u.hi | v.hi, u.lo | v.lo}
+}
+
+func (u uint128) next() uint128 {
+	if u.lo == math.MaxUint64 {
+		return uint128{u.hi + 1, 0}
+	}
+	return uint128{u.hi, u.lo + 1}
+}
+
+func (u uint128) trailingZeros() int {
+	if u.lo != 0 {
+		return bits.TrailingZeros64(u.lo)
+	}
+	if u.hi != 0 {
+		return 64 + bits.TrailingZeros64(u.hi)
+	}
+	return 128
+}
+
+// bit returns the i-th bit of the address, from the most significant.
+func (u uint128) bit(i int) int {
+	if i < 64 {
+		return int(u.hi>>uint(63-i)) & 1
+	}
+	return int(u.lo>>uint(127-i)) & 1
+}
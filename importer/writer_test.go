@@ -0,0 +1,110 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package importer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+func TestWriter(t *testing.T) {
+	w := NewWriter("Test-DB")
+	w.BuildTime = time.Unix(1500000000, 0)
+	for _, r := range []struct {
+		First, Last, Name string
+	}{
+		{"1.0.0.0", "1.0.0.255", "a"},
+		{"10.0.0.1", "10.0.0.6", "b"},
+		{"10.0.0.4", "10.0.0.4", "c"},
+		{"2a02:f000::", "2a02:f0ff:ffff:ffff:ffff:ffff:ffff:ffff", "d"},
+		{"::ffff:200.1.2.0", "::ffff:200.1.2.255", "a"},
+	} {
+		err := w.InsertRange(net.ParseIP(r.First), net.ParseIP(r.Last), map[string]interface{}{
+			"name":  r.Name,
+			"score": 1.5,
+			"count": uint32(300),
+			"ok":    true,
+			"list":  []interface{}{"x", uint16(7)},
+			"long":  strings.Repeat("z", 300),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var b bytes.Buffer
+	if _, err := w.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	r, err := maxminddb.FromBytes(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Metadata.DatabaseType != "Test-DB" || r.Metadata.IPVersion != 6 || r.Metadata.BuildEpoch != 1500000000 {
+		t.Fatalf("Unexpected metadata: %+v", r.Metadata)
+	}
+	if err = r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		IP, Name string
+	}{
+		{"1.0.0.1", "a"},
+		{"1.0.1.1", ""},
+		{"10.0.0.0", ""},
+		{"10.0.0.1", "b"},
+		{"10.0.0.3", "b"},
+		{"10.0.0.4", "c"},
+		{"10.0.0.6", "b"},
+		{"10.0.0.7", ""},
+		{"200.1.2.3", "a"},
+		{"2a02:f012::1", "d"},
+		{"2a02:f100::1", ""},
+	} {
+		var rec struct {
+			Name  string        `maxminddb:"name"`
+			Score float64       `maxminddb:"score"`
+			Count uint          `maxminddb:"count"`
+			OK    bool          `maxminddb:"ok"`
+			List  []interface{} `maxminddb:"list"`
+			Long  string        `maxminddb:"long"`
+		}
+		if err = r.Lookup(net.ParseIP(test.IP), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Name != test.Name {
+			t.Errorf("Unexpected record of %s: want %q, have %q", test.IP, test.Name, rec.Name)
+		}
+		if rec.Name != "" && (rec.Score != 1.5 || rec.Count != 300 || !rec.OK || len(rec.List) != 2 || len(rec.Long) != 300) {
+			t.Errorf("Unexpected record of %s: %+v", test.IP, rec)
+		}
+	}
+}
+
+func TestWriterInvalidRange(t *testing.T) {
+	w := NewWriter("Test-DB")
+	for _, r := range [][2]string{
+		{"10.0.0.2", "10.0.0.1"},
+		{"10.0.0.1", "2a02::"},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{"::", "::ffff"},
+		{"::1", "10.0.0.1"},
+		{"0.0.0.0", "::ffff"},
+	} {
+		err := w.InsertRange(net.ParseIP(r[0]), net.ParseIP(r[1]), map[string]interface{}{})
+		if err == nil {
+			t.Errorf("Unexpected range was inserted: %s-%s", r[0], r[1])
+		}
+	}
+	err := w.InsertRange(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), map[string]interface{}{"n": 1})
+	if err == nil {
+		t.Error("Unexpected record of unsupported type was inserted")
+	}
+}
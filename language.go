@@ -0,0 +1,60 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"golang.org/x/text/language"
+)
+
+// DefaultLanguage is the language of names when none of the languages
+// of requests is in the database.
+const DefaultLanguage = "en"
+
+// languageMatcher matches the languages of requests with the languages
+// of names in a database. It's built once per database, when loaded.
+type languageMatcher struct {
+	langs   []string // Languages as in the database, by index of tags.
+	matcher language.Matcher
+}
+
+func newLanguageMatcher(langs []string) *languageMatcher {
+	m := &languageMatcher{langs: []string{DefaultLanguage}}
+	tags := []language.Tag{language.Make(DefaultLanguage)}
+	for _, lang := range langs {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			continue
+		}
+		m.langs = append(m.langs, lang)
+		tags = append(tags, tag)
+	}
+	m.matcher = language.NewMatcher(tags)
+	return m
+}
+
+// match returns the language of the database that best matches the
+// Accept-Language header value accept, or DefaultLanguage.
+func (m *languageMatcher) match(accept string) string {
+	tags, _, err := language.ParseAcceptLanguage(accept)
+	if err != nil || len(tags) == 0 {
+		return DefaultLanguage
+	}
+	_, i, conf := m.matcher.Match(tags...)
+	if conf == language.No {
+		return DefaultLanguage
+	}
+	return m.langs[i]
+}
+
+// Language returns the language of names in the database that best
+// matches the Accept-Language header value accept, e.g. "de-DE, en;q=0.8",
+// or DefaultLanguage if none does or no database is loaded yet.
+func (db *DB) Language(accept string) string {
+	r := db.current()
+	if r == nil {
+		return DefaultLanguage
+	}
+	return r.langs.match(accept)
+}
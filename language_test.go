@@ -0,0 +1,59 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"testing"
+)
+
+func TestLanguageMatcher(t *testing.T) {
+	cases := []struct {
+		langs  []string
+		accept string
+		want   string
+	}{
+		{[]string{"en", "de", "ro", "fr"}, "de", "de"},
+		{[]string{"en", "de", "ro", "fr"}, "de-DE", "de"},
+		{[]string{"en", "de", "ro", "fr"}, "de-DE, en", "de"},
+		{[]string{"en", "de", "ro", "fr"}, "en-US, de-DE", "en"},
+		{[]string{"en", "de", "ro", "fr"}, "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "fr"},
+		{[]string{"en", "de", "ro", "fr"}, "en;q=0.1, de;q=0.8, fr;q=0.7, *;q=0.5", "de"},
+		{[]string{"en", "de", "pt-BR", "zh-CN"}, "pt-BR", "pt-BR"},
+		{[]string{"en", "de", "pt-BR", "zh-CN"}, "zh", "zh-CN"},
+		{[]string{"en", "de", "ro", "fr"}, "", "en"},
+		{[]string{"en", "de", "ro", "fr"}, "invalid;q=x", "en"},
+
+		// Less languages.
+		{[]string{"en", "de"}, "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "en"},
+
+		// No languages.
+		{nil, "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "en"},
+		{nil, "ja", "en"},
+	}
+	for _, c := range cases {
+		m := newLanguageMatcher(c.langs)
+		if lang := m.match(c.accept); lang != c.want {
+			t.Errorf("Unexpected language of %q with %v: want %q, have %q", c.accept, c.langs, c.want, lang)
+		}
+	}
+}
+
+func TestDBLanguage(t *testing.T) {
+	db := &DB{}
+	if lang := db.Language("de"); lang != DefaultLanguage {
+		t.Fatalf("Unexpected language without database: %q", lang)
+	}
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if lang := db.Language("de-DE, en;q=0.8"); lang != "de" {
+		t.Fatalf("Unexpected language: want de, have %q", lang)
+	}
+	if lang := db.Language("es-VE"); lang != "es" {
+		t.Fatalf("Unexpected language: want es, have %q", lang)
+	}
+}
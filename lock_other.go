@@ -0,0 +1,21 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package freegeoip
+
+import "sync"
+
+// lockMu serializes updates of all DBs, on platforms without file
+// locks. Concurrent processes might download the same update.
+var lockMu sync.Mutex
+
+// lock acquires an exclusive lock of the given file. On this platform
+// the lock is not shared with other processes.
+func lock(name string) (unlock func(), err error) {
+	lockMu.Lock()
+	return lockMu.Unlock, nil
+}
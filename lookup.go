@@ -0,0 +1,195 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"context"
+	"net"
+)
+
+// City is the record of an IP address in the GeoIP2-City and
+// GeoLite2-City databases. See DB.LookupCity.
+type City struct {
+	Network *net.IPNet `maxminddb:"-"` // Network of the record.
+	Found   bool       `maxminddb:"-"` // Whether the IP is in the database.
+
+	City               CityRecord          `maxminddb:"city"`
+	Continent          ContinentRecord     `maxminddb:"continent"`
+	Country            CountryRecord       `maxminddb:"country"`
+	Location           LocationRecord      `maxminddb:"location"`
+	Postal             PostalRecord        `maxminddb:"postal"`
+	RegisteredCountry  CountryRecord       `maxminddb:"registered_country"`
+	RepresentedCountry CountryRecord       `maxminddb:"represented_country"`
+	Subdivisions       []SubdivisionRecord `maxminddb:"subdivisions"`
+	Traits             TraitsRecord        `maxminddb:"traits"`
+}
+
+// Country is the record of an IP address in the GeoIP2-Country and
+// GeoLite2-Country databases. See DB.LookupCountry.
+type Country struct {
+	Network *net.IPNet `maxminddb:"-"` // Network of the record.
+	Found   bool       `maxminddb:"-"` // Whether the IP is in the database.
+
+	Continent          ContinentRecord `maxminddb:"continent"`
+	Country            CountryRecord   `maxminddb:"country"`
+	RegisteredCountry  CountryRecord   `maxminddb:"registered_country"`
+	RepresentedCountry CountryRecord   `maxminddb:"represented_country"`
+	Traits             TraitsRecord    `maxminddb:"traits"`
+}
+
+// ASN is the record of an IP address in the GeoIP2-ASN and
+// GeoLite2-ASN databases. See DB.LookupASN.
+type ASN struct {
+	Network *net.IPNet `maxminddb:"-"` // Network of the record.
+	Found   bool       `maxminddb:"-"` // Whether the IP is in the database.
+
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// CityRecord is the city of a City record.
+type CityRecord struct {
+	GeoNameID uint              `maxminddb:"geoname_id"`
+	Names     map[string]string `maxminddb:"names"`
+}
+
+// ContinentRecord is the continent of City and Country records.
+type ContinentRecord struct {
+	Code      string            `maxminddb:"code"`
+	GeoNameID uint              `maxminddb:"geoname_id"`
+	Names     map[string]string `maxminddb:"names"`
+}
+
+// CountryRecord is a country of City and Country records. The Type is
+// only set for represented countries, e.g. military.
+type CountryRecord struct {
+	GeoNameID         uint              `maxminddb:"geoname_id"`
+	IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	ISOCode           string            `maxminddb:"iso_code"`
+	Names             map[string]string `maxminddb:"names"`
+	Type              string            `maxminddb:"type"`
+}
+
+// LocationRecord is the location of a City record.
+type LocationRecord struct {
+	AccuracyRadius uint16  `maxminddb:"accuracy_radius"`
+	Latitude       float64 `maxminddb:"latitude"`
+	Longitude      float64 `maxminddb:"longitude"`
+	MetroCode      uint    `maxminddb:"metro_code"`
+	TimeZone       string  `maxminddb:"time_zone"`
+}
+
+// PostalRecord is the postal code of a City record.
+type PostalRecord struct {
+	Code string `maxminddb:"code"`
+}
+
+// SubdivisionRecord is a subdivision of a City record, e.g. a state
+// or province, from the largest to the smallest.
+type SubdivisionRecord struct {
+	GeoNameID uint              `maxminddb:"geoname_id"`
+	ISOCode   string            `maxminddb:"iso_code"`
+	Names     map[string]string `maxminddb:"names"`
+}
+
+// TraitsRecord is the traits of City and Country records.
+type TraitsRecord struct {
+	IsAnonymousProxy    bool `maxminddb:"is_anonymous_proxy"`
+	IsSatelliteProvider bool `maxminddb:"is_satellite_provider"`
+}
+
+// LookupNetwork performs a database lookup of the given IP address like
+// Lookup, and also returns the network of the record, and whether the
+// IP address was found in the database. When it's not found, the
+// result value is not modified and the network is the largest network
+// containing the IP address that has no records.
+//
+// Addresses in networks of the overlay are always found, and their
+// network is the narrowest of the record and the override. See Overlay.
+func (db *DB) LookupNetwork(addr net.IP, result interface{}) (network *net.IPNet, found bool, err error) {
+	r := db.acquire(addr)
+	if r == nil {
+		return nil, false, ErrUnavailable
+	}
+	defer r.release(addr)
+	network, found, err = r.LookupNetwork(addr, result)
+	if err != nil {
+		return nil, false, err
+	}
+	if o := db.matchOverlay(addr); o != nil {
+		// Report the network of the override when it's narrower.
+		o.apply(result)
+		ones, _ := o.network.Mask.Size()
+		if cur, _ := network.Mask.Size(); !found || ones > cur {
+			network = o.network
+		}
+		found = true
+	}
+	return network, found, nil
+}
+
+// LookupCity performs a database lookup of the given IP address, and
+// returns its City record. Databases other than GeoIP2-City and
+// GeoLite2-City only set the fields they have, e.g. Country.
+func (db *DB) LookupCity(addr net.IP) (*City, error) {
+	var record City
+	var err error
+	record.Network, record.Found, err = db.LookupNetwork(addr, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// LookupCountry performs a database lookup of the given IP address, and
+// returns its Country record. It works with the City databases too.
+func (db *DB) LookupCountry(addr net.IP) (*Country, error) {
+	var record Country
+	var err error
+	record.Network, record.Found, err = db.LookupNetwork(addr, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// LookupASN performs a database lookup of the given IP address, and
+// returns its ASN record.
+func (db *DB) LookupASN(addr net.IP) (*ASN, error) {
+	var record ASN
+	var err error
+	record.Network, record.Found, err = db.LookupNetwork(addr, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// LookupCityContext performs a database lookup like LookupCity, waiting
+// for the database to be loaded first. See WaitReady.
+func (db *DB) LookupCityContext(ctx context.Context, addr net.IP) (*City, error) {
+	if err := db.WaitReady(ctx); err != nil {
+		return nil, err
+	}
+	return db.LookupCity(addr)
+}
+
+// LookupCountryContext performs a database lookup like LookupCountry,
+// waiting for the database to be loaded first. See WaitReady.
+func (db *DB) LookupCountryContext(ctx context.Context, addr net.IP) (*Country, error) {
+	if err := db.WaitReady(ctx); err != nil {
+		return nil, err
+	}
+	return db.LookupCountry(addr)
+}
+
+// LookupASNContext performs a database lookup like LookupASN, waiting
+// for the database to be loaded first. See WaitReady.
+func (db *DB) LookupASNContext(ctx context.Context, addr net.IP) (*ASN, error) {
+	if err := db.WaitReady(ctx); err != nil {
+		return nil, err
+	}
+	return db.LookupASN(addr)
+}
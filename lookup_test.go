@@ -0,0 +1,99 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestLookupCity(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ip := net.ParseIP("200.1.2.3")
+	record, err := db.LookupCity(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Found || record.Network == nil || !record.Network.Contains(ip) {
+		t.Fatalf("Unexpected record network: %v, found: %v", record.Network, record.Found)
+	}
+	if record.Country.ISOCode != "VE" || record.City.Names["en"] != "Caracas" {
+		t.Fatalf("Unexpected record: %+v", record)
+	}
+}
+
+func TestLookupCountry(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	record, err := db.LookupCountry(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Found || record.Country.ISOCode != "US" {
+		t.Fatalf("Unexpected record: %+v", record)
+	}
+}
+
+func TestLookupASN(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// The test database is a city database, so no ASN data.
+	record, err := db.LookupASN(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Found || record.AutonomousSystemNumber != 0 {
+		t.Fatalf("Unexpected record: %+v", record)
+	}
+}
+
+func TestLookupNetworkNotFound(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ip := net.ParseIP("127.0.0.1")
+	record, err := db.LookupCity(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Found {
+		t.Fatalf("Unexpected record: %+v", record)
+	}
+	if record.Network == nil || !record.Network.Contains(ip) {
+		t.Fatal("Unexpected network:", record.Network)
+	}
+	_, _, err = newPendingDB().LookupNetwork(ip, &City{})
+	if err != ErrUnavailable {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestLookupCityContext(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	record, err := db.LookupCityContext(context.Background(), net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+}
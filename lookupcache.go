@@ -0,0 +1,242 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"container/list"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// CacheStats are the statistics of the lookup cache of a DB.
+// See LookupCache.
+type CacheStats struct {
+	Hits    uint64 // Lookups served from the cache.
+	Misses  uint64 // Lookups decoded from the database.
+	Entries int    // Records in the cache.
+}
+
+// lookupKey identifies a decoded record in the lookup cache. All IP
+// addresses of a network share the record offset of the network, and
+// keys of readers that were replaced are never looked up again.
+type lookupKey struct {
+	reader *refReader
+	offset uintptr
+	typ    reflect.Type
+}
+
+type lookupEntry struct {
+	key   lookupKey
+	value reflect.Value // Pointer to the decoded record.
+}
+
+// lookupCache is a bounded LRU cache of decoded records of the reader
+// in use by the DB.
+type lookupCache struct {
+	hits   uint64 // Accessed atomically.
+	misses uint64 // Accessed atomically.
+
+	mu     sync.Mutex
+	size   int
+	ll     *list.List
+	items  map[lookupKey]*list.Element
+	reader *refReader // Reader of the records in the cache.
+}
+
+func newLookupCache(size int) *lookupCache {
+	return &lookupCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[lookupKey]*list.Element),
+	}
+}
+
+func (c *lookupCache) get(key lookupKey) (reflect.Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*lookupEntry).value, true
+	}
+	return reflect.Value{}, false
+}
+
+// add adds the record to the cache, unless it's of a reader that is
+// no longer in use, e.g. of a lookup that started before a reload.
+// Records of old readers would keep them in memory until evicted.
+func (c *lookupCache) add(key lookupKey, value reflect.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key.reader != c.reader {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lookupEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lookupEntry{key, value})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lookupEntry).key)
+	}
+}
+
+// purge removes all records from the cache, and sets the reader of the
+// records added from now on, or nil.
+func (c *lookupCache) purge(r *refReader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reader = r
+	c.ll.Init()
+	c.items = make(map[lookupKey]*list.Element)
+}
+
+func (c *lookupCache) stats() CacheStats {
+	c.mu.Lock()
+	entries := c.ll.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: entries,
+	}
+}
+
+// lookup performs a lookup on the reader like Reader.Lookup, using the
+// cache for results that are pointers to structs.
+func (c *lookupCache) lookup(r *refReader, addr net.IP, result interface{}) error {
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return r.Lookup(addr, result)
+	}
+	offset, err := r.LookupOffset(addr)
+	if err != nil {
+		return err
+	}
+	if offset == maxminddb.NotFound {
+		return nil
+	}
+	key := lookupKey{reader: r, offset: offset, typ: rv.Type()}
+	value, ok := c.get(key)
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+		value = reflect.New(rv.Type().Elem())
+		if err = r.Decode(offset, value.Interface()); err != nil {
+			return err
+		}
+		c.add(key, value)
+	}
+	mergeValue(rv.Elem(), value.Elem())
+	return nil
+}
+
+// mergeValue sets the fields of dst that are set in src, recursively,
+// as decoding a record into dst would. This keeps the fields of dst
+// that are not in the record, e.g. for Manager.LookupAll. Maps and
+// slices are copied, so results don't share them with the cache.
+//
+// Unlike decoding, fields that are zero in src are skipped even when
+// the record has them, as src doesn't tell them apart from missing
+// ones. See LookupCache.
+func mergeValue(dst, src reflect.Value) {
+	if src.Kind() == reflect.Struct {
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				mergeValue(dst.Field(i), src.Field(i))
+			}
+		}
+		return
+	}
+	if !isZeroValue(src) {
+		dst.Set(copyValue(src))
+	}
+}
+
+// copyValue returns a deep copy of v.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			m.SetMapIndex(k, copyValue(v.MapIndex(k)))
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return s
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(copyValue(v.Elem()))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		i := reflect.New(v.Type()).Elem()
+		i.Set(copyValue(v.Elem()))
+		return i
+	case reflect.Struct:
+		s := reflect.New(v.Type()).Elem()
+		s.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if s.Field(i).CanSet() {
+				s.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return s
+	}
+	return v
+}
+
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Array:
+		return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+	}
+	return false
+}
+
+// CacheStats returns the statistics of the lookup cache of the DB, or
+// zero values when it has no cache. See LookupCache.
+func (db *DB) CacheStats() CacheStats {
+	if db.lookupCache == nil {
+		return CacheStats{}
+	}
+	return db.lookupCache.stats()
+}
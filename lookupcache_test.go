@@ -0,0 +1,176 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLookupCache(t *testing.T) {
+	db, err := Open(testFile, LookupCache(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Both addresses are in 8.8.8.0/24.
+	for _, ip := range []string{"8.8.8.8", "8.8.8.4", "8.8.8.8"} {
+		var record DefaultQuery
+		if err = db.Lookup(net.ParseIP(ip), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Country.ISOCode != "US" {
+			t.Fatalf("Unexpected ISO code of %s: %q", ip, record.Country.ISOCode)
+		}
+	}
+	var record DefaultQuery
+	if err = db.Lookup(net.ParseIP("127.0.0.1"), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "" {
+		t.Fatalf("Unexpected ISO code: %q", record.Country.ISOCode)
+	}
+	want := CacheStats{Hits: 2, Misses: 1, Entries: 1}
+	if stats := db.CacheStats(); stats != want {
+		t.Fatalf("Unexpected stats: want %+v, have %+v", want, stats)
+	}
+
+	// Results of other types are cached separately.
+	var country struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &country); err != nil {
+		t.Fatal(err)
+	}
+	if country.Country.ISOCode != "US" {
+		t.Fatalf("Unexpected ISO code: %q", country.Country.ISOCode)
+	}
+	if stats := db.CacheStats(); stats.Entries != 2 {
+		t.Fatalf("Unexpected number of entries: want 2, have %d", stats.Entries)
+	}
+
+	// Loading a database clears the cache.
+	reader, checksum, err := db.newReader(db.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.setReader(reader, time.Now(), checksum, "")
+	if stats := db.CacheStats(); stats.Entries != 0 {
+		t.Fatalf("Unexpected number of entries: want 0, have %d", stats.Entries)
+	}
+}
+
+func TestLookupCacheStale(t *testing.T) {
+	db, err := Open(testFile, LookupCache(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stale := db.current()
+	reader, checksum, err := db.newReader(db.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.setReader(reader, time.Now(), checksum, "")
+	// A lookup that started before the reload adds its record late.
+	db.lookupCache.add(lookupKey{reader: stale}, reflect.ValueOf(&DefaultQuery{}))
+	if stats := db.CacheStats(); stats.Entries != 0 {
+		t.Fatalf("Unexpected number of entries: want 0, have %d", stats.Entries)
+	}
+}
+
+func TestLookupCacheCopy(t *testing.T) {
+	db, err := Open(testFile, LookupCache(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var record DefaultQuery
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+		t.Fatal(err)
+	}
+	want := record.Country.Names["en"]
+	record.Country.Names["en"] = "changed"
+	record = DefaultQuery{}
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+		t.Fatal(err)
+	}
+	if name := record.Country.Names["en"]; name != want {
+		t.Fatalf("Unexpected name: want %q, have %q", want, name)
+	}
+	if stats := db.CacheStats(); stats.Hits != 1 {
+		t.Fatalf("Unexpected hits: want 1, have %d", stats.Hits)
+	}
+}
+
+func TestLookupCacheEvict(t *testing.T) {
+	db, err := Open(testFile, LookupCache(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, ip := range []string{"8.8.8.8", "200.1.2.3", "8.8.8.8"} {
+		var record DefaultQuery
+		if err = db.Lookup(net.ParseIP(ip), &record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := CacheStats{Hits: 0, Misses: 3, Entries: 1}
+	if stats := db.CacheStats(); stats != want {
+		t.Fatalf("Unexpected stats: want %+v, have %+v", want, stats)
+	}
+}
+
+func TestLookupCacheMerge(t *testing.T) {
+	db, err := Open(testFile, LookupCache(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 2; i++ {
+		var record DefaultQuery
+		record.AutonomousSystemNumber = 15169
+		if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Country.ISOCode != "US" {
+			t.Fatalf("Unexpected ISO code: %q", record.Country.ISOCode)
+		}
+		if record.AutonomousSystemNumber != 15169 {
+			t.Fatalf("Unexpected ASN: %d", record.AutonomousSystemNumber)
+		}
+	}
+}
+
+func TestLookupCacheUnsupported(t *testing.T) {
+	db, err := Open(testFile, LookupCache(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var record map[string]interface{}
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := record["country"]; !ok {
+		t.Fatal("Unexpected record:", record)
+	}
+	if stats := db.CacheStats(); stats != (CacheStats{}) {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+}
+
+func BenchmarkLookupCache(b *testing.B) {
+	db, err := Open(testFile, LookupCache(1000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	benchmarkLookup(b, db, nil)
+}
@@ -0,0 +1,196 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownDB is returned by Manager.Lookup when there is no
+	// database registered under the given name.
+	ErrUnknownDB = errors.New("unknown database")
+
+	// ErrDuplicateDB is returned when adding a database to a Manager
+	// under a name that is already in use.
+	ErrDuplicateDB = errors.New("duplicate database name")
+)
+
+// Manager manages multiple named databases, e.g. GeoIP2-City,
+// GeoIP2-ASN and GeoIP2-Anonymous-IP, so they can be queried
+// individually or all at once.
+//
+// Each database is a regular DB, and is monitored and updated in
+// background independently of the others.
+type Manager struct {
+	mu    sync.RWMutex
+	names []string       // Names in the order they were added.
+	dbs   map[string]*DB // Databases by name.
+}
+
+// NewManager creates and initializes an empty Manager.
+func NewManager() *Manager {
+	return &Manager{dbs: make(map[string]*DB)}
+}
+
+// Add registers the given database under name. The Manager takes
+// ownership of the database and closes it when the Manager is closed.
+func (m *Manager) Add(name string, db *DB) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.dbs[name]; exists {
+		return fmt.Errorf("%s: %q", ErrDuplicateDB, name)
+	}
+	m.names = append(m.names, name)
+	m.dbs[name] = db
+	return nil
+}
+
+// Open opens the local database file dsn and registers it under name.
+// See Open for details.
+func (m *Manager) Open(name, dsn string, opts ...Option) (*DB, error) {
+	if m.Has(name) {
+		return nil, fmt.Errorf("%s: %q", ErrDuplicateDB, name)
+	}
+	db, err := Open(dsn, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.Add(name, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenURL opens the database at the given URL and registers it under
+// name. See OpenURL for details.
+//
+// Each database keeps its own local copy on $TMPDIR, or in the
+// directory set by the Cache option, named after the database name and
+// the source unless set by the option, so that a database registered
+// under a name used before for another source is downloaded again.
+func (m *Manager) OpenURL(name, url string, updateInterval, maxRetryInterval time.Duration, opts ...Option) (*DB, error) {
+	return m.OpenSource(name, &HTTPSource{URL: url}, updateInterval, maxRetryInterval, opts...)
+}
+
+// OpenSource opens the database from the given Source and registers it
+// under name. See OpenSource for details, and Manager.OpenURL for the
+// local copy of the database.
+func (m *Manager) OpenSource(name string, src Source, updateInterval, maxRetryInterval time.Duration, opts ...Option) (*DB, error) {
+	if m.Has(name) {
+		return nil, fmt.Errorf("%s: %q", ErrDuplicateDB, name)
+	}
+	file := name + "-" + sha256Hex([]byte(src.String()))[:16] + ".db"
+	db, err := openSource(file, src, updateInterval, maxRetryInterval, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.Add(name, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Has returns true if there's a database registered under name.
+func (m *Manager) Has(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, exists := m.dbs[name]
+	return exists
+}
+
+// DB returns the database registered under name, or nil.
+func (m *Manager) DB(name string) *DB {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.dbs[name]
+}
+
+// Names returns the names of all registered databases in the order
+// they were added.
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, len(m.names))
+	copy(names, m.names)
+	return names
+}
+
+// WaitReady blocks until all databases are loaded, or the context is
+// done. See DB.WaitReady.
+func (m *Manager) WaitReady(ctx context.Context) error {
+	m.mu.RLock()
+	dbs := make([]*DB, 0, len(m.names))
+	for _, name := range m.names {
+		dbs = append(dbs, m.dbs[name])
+	}
+	m.mu.RUnlock()
+	for _, db := range dbs {
+		if err := db.WaitReady(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup performs a lookup of the given IP address on the database
+// registered under name. See DB.Lookup for details.
+func (m *Manager) Lookup(name string, addr net.IP, result interface{}) error {
+	db := m.DB(name)
+	if db == nil {
+		return ErrUnknownDB
+	}
+	return db.Lookup(addr, result)
+}
+
+// LookupAll performs a lookup of the given IP address on all
+// databases in the order they were added, and merges the responses
+// into the result value.
+//
+// Because each database only sets the fields it has data for, the
+// result value may combine fields from different database editions,
+// e.g. country and city from GeoIP2-City and autonomous_system_number
+// from GeoIP2-ASN. Fields present in more than one database are set
+// by the last database that has them.
+//
+// Databases that are not available yet are skipped. ErrUnavailable is
+// returned when none of the databases are available.
+func (m *Manager) LookupAll(addr net.IP, result interface{}) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found := false
+	for _, name := range m.names {
+		err := m.dbs[name].Lookup(addr, result)
+		switch err {
+		case nil:
+			found = true
+		case ErrUnavailable:
+		default:
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	if !found {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// Close closes all databases.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.names {
+		m.dbs[name].Close()
+	}
+	m.names = nil
+	m.dbs = make(map[string]*DB)
+}
@@ -0,0 +1,149 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManagerOpen(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	if _, err := m.Open("city", testFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Open("city", testFile); err == nil {
+		t.Fatal("Unexpected duplicate database was added")
+	}
+	if _, err := m.Open("bogus", "db_test.go"); err == nil {
+		t.Fatal("Unexpected bogus db is open")
+	}
+	if names := m.Names(); len(names) != 1 || names[0] != "city" {
+		t.Fatalf("Unexpected names: %q", names)
+	}
+	if m.DB("city") == nil {
+		t.Fatal("Database city is missing")
+	}
+}
+
+func TestManagerLookup(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	if _, err := m.Open("city", testFile); err != nil {
+		t.Fatal(err)
+	}
+	var record DefaultQuery
+	err := m.Lookup("city", net.ParseIP("8.8.8.8"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+	err = m.Lookup("asn", net.ParseIP("8.8.8.8"), &record)
+	if err != ErrUnknownDB {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestManagerLookupAll(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	if _, err := m.Open("city", testFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("pending", newPendingDB()); err != nil {
+		t.Fatal(err)
+	}
+	var record DefaultQuery
+	err := m.LookupAll(net.ParseIP("8.8.8.8"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+}
+
+func TestManagerLookupAllUnavailable(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	if err := m.Add("pending", newPendingDB()); err != nil {
+		t.Fatal(err)
+	}
+	err := m.LookupAll(net.ParseIP("8.8.8.8"), &DefaultQuery{})
+	if err != ErrUnavailable {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestManagerOpenURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/testdata/", http.FileServer(http.Dir(".")))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewManager()
+	defer m.Close()
+	for _, name := range []string{"test-a", "test-b"} {
+		u := srv.URL + "/" + testFile
+		db, err := m.OpenURL(name, u, time.Hour, time.Minute, Cache(CacheOptions{Dir: dir}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := filepath.Join(dir, name+"-"+sha256Hex([]byte(u))[:16]+".db")
+		select {
+		case file := <-db.NotifyOpen():
+			if file != want {
+				t.Fatal("Unexpected db file:", file)
+			}
+		case err := <-db.NotifyError():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out")
+		}
+	}
+}
+
+// newPendingDB returns a DB that has no database loaded yet.
+func newPendingDB() *DB {
+	return &DB{
+		notifyQuit:  make(chan struct{}),
+		notifyOpen:  make(chan string, 1),
+		notifyError: make(chan error, 1),
+		notifyInfo:  make(chan string, 1),
+	}
+}
+
+func TestManagerWaitReady(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	if _, err := m.Open("city", testFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WaitReady(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("pending", newPendingDB()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.WaitReady(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Unexpected error:", err)
+	}
+}
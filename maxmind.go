@@ -0,0 +1,50 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net/url"
+	"strings"
+)
+
+// maxMindDownloadPath is the path of the MaxMind download endpoint.
+const maxMindDownloadPath = "/app/geoip_download"
+
+// MaxMindDownloadURL generates the URL for downloading MaxMind
+// databases using a license key, for example:
+//
+//	MaxMindDownloadURL("download.maxmind.com", "GeoLite2-City", key)
+//
+// The URL points to the tar.gz archive of the given edition ID, which
+// can be passed to OpenURL. DBs created from these URLs check for
+// updates using the SHA-256 checksum published alongside the archive,
+// and only replace the local copy of the database after verifying the
+// download against it.
+func MaxMindDownloadURL(hostname, editionID, licenseKey string) string {
+	params := url.Values{
+		"edition_id":  {editionID},
+		"license_key": {licenseKey},
+		"suffix":      {"tar.gz"},
+	}
+	return "https://" + hostname + maxMindDownloadPath + "?" + params.Encode()
+}
+
+// maxMindChecksumURL returns the URL of the SHA-256 checksum of the
+// database served at u, and true if u is a MaxMind download URL as
+// generated by MaxMindDownloadURL.
+func maxMindChecksumURL(u string) (string, bool) {
+	pu, err := url.Parse(u)
+	if err != nil || pu.Path != maxMindDownloadPath {
+		return "", false
+	}
+	q := pu.Query()
+	suffix := q.Get("suffix")
+	if q.Get("edition_id") == "" || suffix == "" || strings.HasSuffix(suffix, ".sha256") {
+		return "", false
+	}
+	q.Set("suffix", suffix+".sha256")
+	pu.RawQuery = q.Encode()
+	return pu.String(), true
+}
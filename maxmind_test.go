@@ -0,0 +1,188 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxMindDownloadURL(t *testing.T) {
+	u, err := url.Parse(MaxMindDownloadURL("download.maxmind.com", "GeoLite2-City", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	switch {
+	case u.Scheme != "https":
+		t.Fatalf("Unexpected url scheme: want https, have %q", u.Scheme)
+	case u.Host != "download.maxmind.com":
+		t.Fatalf("Unexpected url host: want download.maxmind.com, have %q", u.Host)
+	case u.Path != "/app/geoip_download":
+		t.Fatalf("Unexpected url path: %q", u.Path)
+	case q.Get("edition_id") != "GeoLite2-City":
+		t.Fatalf("Unexpected edition_id: %q", q.Get("edition_id"))
+	case q.Get("license_key") != "secret":
+		t.Fatalf("Unexpected license_key: %q", q.Get("license_key"))
+	case q.Get("suffix") != "tar.gz":
+		t.Fatalf("Unexpected suffix: %q", q.Get("suffix"))
+	}
+}
+
+func TestMaxMindChecksumURL(t *testing.T) {
+	u := MaxMindDownloadURL("download.maxmind.com", "GeoLite2-City", "secret")
+	sumURL, ok := maxMindChecksumURL(u)
+	if !ok {
+		t.Fatal("Not a MaxMind download URL:", u)
+	}
+	if want := strings.Replace(u, "suffix=tar.gz", "suffix=tar.gz.sha256", 1); sumURL != want {
+		t.Fatalf("Unexpected checksum URL: want %q, have %q", want, sumURL)
+	}
+	for _, u := range []string{MaxMindDB, sumURL, "http://localhost/app/geoip_download"} {
+		if _, ok := maxMindChecksumURL(u); ok {
+			t.Fatal("Unexpected MaxMind download URL:", u)
+		}
+	}
+}
+
+// maxMindServer is a stand-in for the MaxMind download endpoint.
+type maxMindServer struct {
+	*httptest.Server
+	archive   []byte
+	checksum  string
+	downloads int32
+}
+
+func newMaxMindServer(t *testing.T) *maxMindServer {
+	ms := &maxMindServer{archive: testGzip(t, testTar(t, testMMDB(t)))}
+	sum := sha256.Sum256(ms.archive)
+	ms.checksum = hex.EncodeToString(sum[:])
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/geoip_download", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("license_key") != "secret" {
+			http.Error(w, "Invalid license key", http.StatusUnauthorized)
+			return
+		}
+		if q.Get("edition_id") != "GeoLite2-City" {
+			http.Error(w, "Invalid product ID or subscription expired", http.StatusForbidden)
+			return
+		}
+		switch q.Get("suffix") {
+		case "tar.gz":
+			atomic.AddInt32(&ms.downloads, 1)
+			w.Write(ms.archive)
+		case "tar.gz.sha256":
+			fmt.Fprintf(w, "%s  GeoLite2-City_20171003.tar.gz\n", ms.checksum)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ms.Server = httptest.NewServer(mux)
+	return ms
+}
+
+// URL returns the download URL for the given license key.
+func (ms *maxMindServer) URL(licenseKey string) string {
+	u := MaxMindDownloadURL("download.maxmind.com", "GeoLite2-City", licenseKey)
+	return strings.Replace(u, "https://download.maxmind.com", ms.Server.URL, 1)
+}
+
+func TestMaxMindUpdate(t *testing.T) {
+	ms := newMaxMindServer(t)
+	defer ms.Close()
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := &DB{file: filepath.Join(dir, "db.tar.gz")}
+	if err = db.runUpdate(&HTTPSource{URL: ms.URL("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if err = verifySHA256(db.file, ms.checksum); err != nil {
+		t.Fatal(err)
+	}
+	// Already up to date.
+	if err = db.runUpdate(&HTTPSource{URL: ms.URL("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&ms.downloads); n != 1 {
+		t.Fatalf("Unexpected number of downloads: want 1, have %d", n)
+	}
+	if _, _, err = db.newReader(db.file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxMindUpdateChecksumMismatch(t *testing.T) {
+	ms := newMaxMindServer(t)
+	defer ms.Close()
+	ms.checksum = strings.Repeat("0", 64)
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := &DB{file: filepath.Join(dir, "db.tar.gz")}
+	if err = db.runUpdate(&HTTPSource{URL: ms.URL("secret")}); err == nil {
+		t.Fatal("Unexpected update with checksum mismatch worked")
+	}
+	if _, err = os.Stat(db.file); err == nil {
+		t.Fatal("Unexpected database file was created")
+	}
+}
+
+func TestMaxMindUpdateBadLicenseKey(t *testing.T) {
+	ms := newMaxMindServer(t)
+	defer ms.Close()
+	db := &DB{file: filepath.Join(os.TempDir(), "does-not-exist")}
+	if err := db.runUpdate(&HTTPSource{URL: ms.URL("bogus")}); err == nil {
+		t.Fatal("Unexpected update with bad license key worked")
+	}
+}
+
+func TestMaxMindOpenURL(t *testing.T) {
+	ms := newMaxMindServer(t)
+	defer ms.Close()
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewManager()
+	defer m.Close()
+	db, err := m.OpenURL("test-maxmind", ms.URL("secret"), time.Hour, time.Minute, Cache(CacheOptions{Dir: dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-db.NotifyOpen():
+	case err := <-db.NotifyError():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out")
+	}
+	var record DefaultQuery
+	err = db.Lookup(net.ParseIP("8.8.8.8"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Metadata describes the database loaded by a DB. See DB.Metadata.
+type Metadata struct {
+	// Fields of the metadata section of the MaxMind DB file.
+	DatabaseType string            `json:"database_type"`
+	Description  map[string]string `json:"description"`
+	Languages    []string          `json:"languages"`
+	BuildEpoch   uint              `json:"build_epoch"`
+	BuildTime    time.Time         `json:"build_time"` // BuildEpoch as time.
+	IPVersion    uint              `json:"ip_version"`
+	RecordSize   uint              `json:"record_size"`
+	NodeCount    uint              `json:"node_count"`
+	FormatMajor  uint              `json:"binary_format_major_version"`
+	FormatMinor  uint              `json:"binary_format_minor_version"`
+
+	// Fields of the database file.
+	File     string    `json:"file"`             // Name of the local file.
+	Source   string    `json:"source,omitempty"` // Source, with secrets redacted.
+	MD5      string    `json:"md5"`              // MD5 of the uncompressed database.
+	SHA256   string    `json:"sha256"`           // SHA-256 of the file, as is.
+	Date     time.Time `json:"date"`             // Modification time of the file.
+	LoadedAt time.Time `json:"loaded_at"`        // Time the database was loaded.
+}
+
+// Metadata returns the metadata of the database in use, or
+// ErrUnavailable if no database is loaded yet.
+func (db *DB) Metadata() (*Metadata, error) {
+	// Readers are only replaced with db.mu locked, so the reader and
+	// the fields of the DB are consistent.
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	r := db.current()
+	if r == nil {
+		return nil, ErrUnavailable
+	}
+	md := r.Metadata
+	// Copy the description and languages, which belong to the reader.
+	desc := make(map[string]string, len(md.Description))
+	for k, v := range md.Description {
+		desc[k] = v
+	}
+	return &Metadata{
+		DatabaseType: md.DatabaseType,
+		Description:  desc,
+		Languages:    append([]string(nil), md.Languages...),
+		BuildEpoch:   md.BuildEpoch,
+		BuildTime:    time.Unix(int64(md.BuildEpoch), 0).UTC(),
+		IPVersion:    md.IPVersion,
+		RecordSize:   md.RecordSize,
+		NodeCount:    md.NodeCount,
+		FormatMajor:  md.BinaryFormatMajorVersion,
+		FormatMinor:  md.BinaryFormatMinorVersion,
+		File:         db.file,
+		Source:       db.source,
+		MD5:          db.checksum,
+		SHA256:       db.sha256,
+		Date:         db.lastUpdated,
+		LoadedAt:     db.loadedAt,
+	}, nil
+}
+
+// redactURL returns the URL without user info, and with the values of
+// query parameters that look like secrets, e.g. license keys, redacted.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return s
+	}
+	u.User = nil
+	q := u.Query()
+	for k := range q {
+		lk := strings.ToLower(k)
+		for _, secret := range []string{"key", "secret", "token", "password", "signature"} {
+			if strings.Contains(lk, secret) {
+				q.Set(k, "REDACTED")
+				break
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// redactError returns err with the URL of url.Errors redacted, as they
+// end up in logs and API responses. Other errors are returned as is.
+func redactError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		return &url.Error{Op: ue.Op, URL: redactURL(ue.URL), Err: ue.Err}
+	}
+	return err
+}
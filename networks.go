@@ -0,0 +1,81 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Record is the record of a network in the database, decoded on
+// demand. See DB.Networks.
+type Record struct {
+	reader *refReader
+	offset uintptr
+}
+
+// Decode decodes the record into the result value, as DB.Lookup does.
+// Records are only valid during the call to the function of
+// DB.Networks they are passed to.
+func (rec Record) Decode(result interface{}) error {
+	return rec.reader.Decode(rec.offset, result)
+}
+
+// NetworksOption configures DB.Networks.
+type NetworksOption func(o *networksOptions)
+
+type networksOptions struct {
+	within *net.IPNet
+}
+
+// Within restricts DB.Networks to the networks within the given
+// network, e.g. 10.0.0.0/8.
+func Within(network *net.IPNet) NetworksOption {
+	return func(o *networksOptions) {
+		o.within = network
+	}
+}
+
+// Networks calls fn for each network in the database that has a
+// record, in order, until fn returns an error, which is returned by
+// Networks. IPv4 networks are reported once, as IPv4 networks, and not
+// again under the IPv6 subtrees that alias them.
+//
+// The database in use when Networks is called is used until it
+// returns, even if a new database is loaded meanwhile.
+func (db *DB) Networks(fn func(network *net.IPNet, rec Record) error, opts ...NetworksOption) error {
+	var o networksOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	r := db.acquire(nil)
+	if r == nil {
+		return ErrUnavailable
+	}
+	defer r.release(nil)
+	var it *maxminddb.Networks
+	if o.within != nil {
+		it = r.NetworksWithin(o.within, maxminddb.SkipAliasedNetworks)
+	} else {
+		it = r.Networks(maxminddb.SkipAliasedNetworks)
+	}
+	var skip struct{} // Records are decoded on demand.
+	for it.Next() {
+		network, err := it.Network(&skip)
+		if err != nil {
+			return err
+		}
+		rec := Record{reader: r}
+		rec.offset, err = r.LookupOffset(network.IP)
+		if err != nil {
+			return err
+		}
+		if err = fn(network, rec); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,83 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestNetworks(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	records := make(map[string]string)
+	err = db.Networks(func(network *net.IPNet, rec Record) error {
+		var record DefaultQuery
+		if err := rec.Decode(&record); err != nil {
+			return err
+		}
+		records[network.String()] = record.Country.ISOCode
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"1.0.0.0/24":     "AU",
+		"8.8.8.0/24":     "US",
+		"81.2.69.0/24":   "DE",
+		"200.1.2.0/24":   "VE",
+		"2a02:f000::/24": "DE",
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("Unexpected networks: want %v, have %v", want, records)
+	}
+}
+
+func TestNetworksWithin(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, within, _ := net.ParseCIDR("8.0.0.0/8")
+	var networks []string
+	err = db.Networks(func(network *net.IPNet, rec Record) error {
+		networks = append(networks, network.String())
+		return nil
+	}, Within(within))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"8.8.8.0/24"}; !reflect.DeepEqual(networks, want) {
+		t.Fatalf("Unexpected networks: want %v, have %v", want, networks)
+	}
+}
+
+func TestNetworksError(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stop := errors.New("stop")
+	n := 0
+	err = db.Networks(func(network *net.IPNet, rec Record) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("Unexpected result: %d networks, error %v", n, err)
+	}
+	err = newPendingDB().Networks(func(*net.IPNet, Record) error { return nil })
+	if err != ErrUnavailable {
+		t.Fatal("Unexpected error:", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+)
+
+// An Option configures optional behaviour of a DB. Options are passed
+// to Open and OpenURL.
+type Option func(db *DB)
+
+// MemoryMap makes the DB memory-map the database file rather than
+// reading it into the heap, so loading and reloading the database
+// barely touches the heap or the garbage collector.
+//
+// Uncompressed .mmdb files are mapped as is. Compressed files and
+// archives are decompressed to a file in the cache directory, see
+// Cache, which is then mapped. They are decompressed again only when
+// the compressed file changes.
+//
+// Mapped files must be replaced by renaming a new file over them, not
+// overwritten in place, otherwise lookups on the old mapping may fail
+// or crash the program.
+func MemoryMap() Option {
+	return func(db *DB) {
+		db.mmap = true
+	}
+}
+
+// SHA256 makes the DB verify files downloaded by OpenURL against the
+// given hex encoded SHA-256 digest, rejecting any other file. This
+// pins the DB to a specific version of the database.
+func SHA256(hexdigest string) Option {
+	return func(db *DB) {
+		db.verifier.sha256 = hexdigest
+	}
+}
+
+// SHA256URL makes the DB verify files downloaded by OpenURL against
+// the SHA-256 digest published in the checksum file at url, in the
+// format of sha256sum: "<hexdigest>  <filename>". The checksum file is
+// also used to check whether the local copy is up to date.
+//
+// DBs downloading from MaxMind download URLs use the checksum files
+// published by MaxMind by default.
+func SHA256URL(url string) Option {
+	return func(db *DB) {
+		db.verifier.sha256URL = url
+	}
+}
+
+// Signature makes the DB verify files downloaded by OpenURL against
+// the detached ed25519 signature at url, made with the private key of
+// the given public key. The signature is of the downloaded file as is,
+// and the signature file may be raw or base64 encoded.
+func Signature(url string, publicKey ed25519.PublicKey) Option {
+	return func(db *DB) {
+		db.verifier.sigURL = url
+		db.verifier.publicKey = publicKey
+	}
+}
+
+// Validate makes the DB validate new database files before loading
+// them, either when opening the DB or when the file is updated. Files
+// that fail validation are not loaded, and the DB keeps using the
+// database that it already has. Errors are reported by NotifyError.
+func Validate(v Validation) Option {
+	return func(db *DB) {
+		db.validation = &v
+	}
+}
+
+// KeepVersions sets the number of previous versions of the database
+// file that DBs created by OpenURL keep when replacing it with a new
+// version, for DB.Rollback. The default is 1.
+func KeepVersions(n int) Option {
+	return func(db *DB) {
+		db.keepVersions = n
+	}
+}
+
+// Cache sets the directory and file name of the local copy of the
+// database that DBs created by OpenURL and OpenSource keep. The
+// directory is also where MemoryMap decompresses files to.
+func Cache(o CacheOptions) Option {
+	return func(db *DB) {
+		db.cache = o
+	}
+}
+
+// LookupCache makes the DB cache up to size decoded records in memory,
+// evicting the least recently used ones. Records are cached by their
+// offset in the database file and the type of the result, so all IP
+// addresses of a network, and all networks that share a record, share
+// the same entry. The cache is cleared when a new database is loaded.
+// See DB.CacheStats.
+//
+// Only results that are pointers to structs are cached. Cached records
+// are copied into results, maps and slices included, so results can be
+// modified freely. Fields of results that are zero in the record are
+// left as they are rather than zeroed, so results should be fresh
+// values, not reused across lookups.
+func LookupCache(size int) Option {
+	return func(db *DB) {
+		if size > 0 {
+			db.lookupCache = newLookupCache(size)
+		}
+	}
+}
+
+// Overlay makes the DB override the records of networks listed in the
+// given file, e.g. to correct the location of corporate networks. The
+// file is reloaded automatically when it changes.
+//
+// The overrides of the network that most specifically matches the IP
+// address are applied to the results of lookups, on top of the
+// database record. The file is YAML (.yaml or .yml) with a list of
+// overrides, or CSV (.csv) with a header row naming the fields, e.g.:
+//
+//	# overlay.yaml
+//	- network: 192.0.2.0/24
+//	  country: US
+//	  country_name: United States
+//	  region: CA
+//	  region_name: California
+//	  city: San Francisco
+//	  postal_code: "94105"
+//	  time_zone: America/Los_Angeles
+//	  latitude: 37.7898
+//	  longitude: -122.3942
+//
+// All fields but network are optional. Overriding the country, region
+// or city replaces it entirely, and its name is set in English only.
+func Overlay(file string) Option {
+	return func(db *DB) {
+		db.overlayFile = filepath.Clean(file)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// override is an entry of an overlay file, with the fields that are
+// overridden in the records of the network. See Overlay.
+type override struct {
+	Network     string   `yaml:"network"`
+	Country     string   `yaml:"country"`
+	CountryName string   `yaml:"country_name"`
+	Region      string   `yaml:"region"`
+	RegionName  string   `yaml:"region_name"`
+	City        string   `yaml:"city"`
+	PostalCode  string   `yaml:"postal_code"`
+	TimeZone    string   `yaml:"time_zone"`
+	Latitude    *float64 `yaml:"latitude"`
+	Longitude   *float64 `yaml:"longitude"`
+
+	network *net.IPNet
+}
+
+// overlay is a set of overrides, matched by longest prefix.
+type overlay struct {
+	// Overrides by prefix length and network address, for IPv4 and
+	// IPv6 networks respectively.
+	v4, v6 map[int]map[string]*override
+	// Prefix lengths in use, longest first.
+	v4len, v6len []int
+}
+
+// loadOverlay loads the overlay file, in YAML or CSV format depending
+// on its extension.
+func loadOverlay(name string) (*overlay, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []*override
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		entries, err = readOverlayYAML(f)
+	case ".csv":
+		entries, err = readOverlayCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported overlay file %s: must be .yaml, .yml or .csv", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overlay %s: %s", name, err)
+	}
+	return newOverlay(entries)
+}
+
+func readOverlayYAML(r io.Reader) ([]*override, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*override
+	if err = yaml.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// readOverlayCSV reads overrides from CSV with a header row, which has
+// the names of the fields of the YAML format, e.g. network,country.
+func readOverlayCSV(r io.Reader) ([]*override, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*override
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		o := &override{}
+		for i, v := range row {
+			if err = o.set(header[i], v); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+		}
+		entries = append(entries, o)
+	}
+}
+
+// set sets the field of the override with the given name.
+func (o *override) set(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	var err error
+	parseFloat := func() *float64 {
+		var f float64
+		f, err = strconv.ParseFloat(value, 64)
+		return &f
+	}
+	switch field {
+	case "network":
+		o.Network = value
+	case "country":
+		o.Country = value
+	case "country_name":
+		o.CountryName = value
+	case "region":
+		o.Region = value
+	case "region_name":
+		o.RegionName = value
+	case "city":
+		o.City = value
+	case "postal_code":
+		o.PostalCode = value
+	case "time_zone":
+		o.TimeZone = value
+	case "latitude":
+		o.Latitude = parseFloat()
+	case "longitude":
+		o.Longitude = parseFloat()
+	default:
+		return fmt.Errorf("unknown field %q", field)
+	}
+	return err
+}
+
+func newOverlay(entries []*override) (*overlay, error) {
+	ov := &overlay{
+		v4: make(map[int]map[string]*override),
+		v6: make(map[int]map[string]*override),
+	}
+	for i, o := range entries {
+		_, network, err := net.ParseCIDR(o.Network)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", i+1, err)
+		}
+		o.network = network
+		ones, _ := network.Mask.Size()
+		table := ov.v6
+		if len(network.IP) == net.IPv4len {
+			table = ov.v4
+		}
+		if table[ones] == nil {
+			table[ones] = make(map[string]*override)
+		}
+		table[ones][string(network.IP)] = o
+	}
+	ov.v4len = prefixLengths(ov.v4)
+	ov.v6len = prefixLengths(ov.v6)
+	return ov, nil
+}
+
+func prefixLengths(table map[int]map[string]*override) []int {
+	var lengths []int
+	for n := range table {
+		lengths = append(lengths, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	return lengths
+}
+
+// match returns the override of the longest network that contains
+// the IP address, or nil.
+func (ov *overlay) match(addr net.IP) *override {
+	table, lengths := ov.v6, ov.v6len
+	if ip := addr.To4(); ip != nil {
+		addr, table, lengths = ip, ov.v4, ov.v4len
+	}
+	for _, n := range lengths {
+		ip := addr.Mask(net.CIDRMask(n, len(addr)*8))
+		if o, ok := table[n][string(ip)]; ok {
+			return o
+		}
+	}
+	return nil
+}
+
+// apply overrides the fields of the result value, which is decoded
+// from the database as in DB.Lookup. Fields are matched by their
+// maxminddb tags, and fields the result doesn't have are ignored.
+//
+// Overriding the country, region or city replaces it entirely, e.g.
+// its names in all languages, which are set in English only.
+func (o *override) apply(result interface{}) {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	v = v.Elem()
+	set := func(value interface{}, path ...string) {
+		var rv reflect.Value
+		if value != nil {
+			rv = reflect.ValueOf(value)
+		}
+		setPath(v, path, rv)
+	}
+	if o.Country != "" || o.CountryName != "" {
+		set(nil, "country")
+		if o.Country != "" {
+			set(o.Country, "country", "iso_code")
+		}
+		if o.CountryName != "" {
+			set(o.CountryName, "country", "names", "en")
+		}
+	}
+	if o.Region != "" || o.RegionName != "" {
+		set(nil, "subdivisions")
+		if o.Region != "" {
+			set(o.Region, "subdivisions", "0", "iso_code")
+		}
+		if o.RegionName != "" {
+			set(o.RegionName, "subdivisions", "0", "names", "en")
+		}
+	}
+	if o.City != "" {
+		set(nil, "city")
+		set(o.City, "city", "names", "en")
+	}
+	if o.PostalCode != "" {
+		set(o.PostalCode, "postal", "code")
+	}
+	if o.TimeZone != "" {
+		set(o.TimeZone, "location", "time_zone")
+	}
+	if o.Latitude != nil {
+		set(*o.Latitude, "location", "latitude")
+	}
+	if o.Longitude != nil {
+		set(*o.Longitude, "location", "longitude")
+	}
+}
+
+// setPath sets the value at the path of maxminddb struct tags, map
+// keys or slice indexes in v, creating intermediate values as needed.
+// An invalid value sets the zero value, or removes map keys.
+func setPath(v reflect.Value, path []string, value reflect.Value) {
+	if len(path) == 0 && !value.IsValid() {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		switch {
+		case value.Type().AssignableTo(v.Type()):
+			v.Set(value)
+		case value.Type().ConvertibleTo(v.Type()):
+			v.Set(value.Convert(v.Type()))
+		}
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("maxminddb"), ",")[0]
+			if tag == path[0] && v.Field(i).CanSet() {
+				setPath(v.Field(i), path[1:], value)
+				return
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		if len(path) == 1 && !value.IsValid() {
+			if !v.IsNil() {
+				v.SetMapIndex(key, reflect.Value{})
+			}
+			return
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if cur := v.MapIndex(key); cur.IsValid() {
+			elem.Set(cur)
+		}
+		setPath(elem, path[1:], value)
+		v.SetMapIndex(key, elem)
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil {
+			return
+		}
+		for v.Len() <= i {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		setPath(v.Index(i), path[1:], value)
+	case reflect.Interface:
+		// Generic results, e.g. map[string]interface{}.
+		var elem reflect.Value
+		if !v.IsNil() {
+			elem = reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+		}
+		if _, err := strconv.Atoi(path[0]); err == nil {
+			if !elem.IsValid() || elem.Kind() != reflect.Slice {
+				elem = reflect.ValueOf(&[]interface{}{}).Elem()
+			}
+		} else if !elem.IsValid() || elem.Kind() != reflect.Map {
+			elem = reflect.ValueOf(map[string]interface{}{})
+		}
+		setPath(elem, path, value)
+		v.Set(elem)
+	}
+}
+
+// loadOverlay loads the overlay file of the DB, if any, replacing the
+// overlay in use.
+func (db *DB) loadOverlay() error {
+	if db.overlayFile == "" {
+		return nil
+	}
+	ov, err := loadOverlay(db.overlayFile)
+	if err != nil {
+		return err
+	}
+	db.overlay.Store(ov)
+	return nil
+}
+
+// matchOverlay returns the override of the IP address in the overlay
+// of the DB, or nil.
+func (db *DB) matchOverlay(addr net.IP) *override {
+	ov, _ := db.overlay.Load().(*overlay)
+	if ov == nil {
+		return nil
+	}
+	return ov.match(addr)
+}
@@ -0,0 +1,177 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testOverlayYAML = `
+- network: 8.8.8.0/25
+  country: BR
+  country_name: Brazil
+  city: Sao Paulo
+  latitude: -23.5
+  longitude: -46.6
+- network: 8.0.0.0/8
+  region: CA
+  region_name: California
+- network: 10.0.0.0/8
+  country: US
+  time_zone: America/New_York
+`
+
+func writeOverlay(t *testing.T, name, content string) (file, dir string) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file = filepath.Join(dir, name)
+	if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return file, dir
+}
+
+func TestOverlay(t *testing.T) {
+	file, dir := writeOverlay(t, "overlay.yaml", testOverlayYAML)
+	defer os.RemoveAll(dir)
+	db, err := Open(testFile, Overlay(file), LookupCache(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The most specific network is used.
+	var record DefaultQuery
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "BR" || record.Country.Names["en"] != "Brazil" || len(record.Country.Names) != 1 {
+		t.Fatalf("Unexpected country: %+v", record.Country)
+	}
+	if record.City.Names["en"] != "Sao Paulo" || record.Location.Latitude != -23.5 || record.Location.Longitude != -46.6 {
+		t.Fatalf("Unexpected location: %+v %+v", record.City, record.Location)
+	}
+	if len(record.Region) != 0 {
+		t.Fatalf("Unexpected region: %+v", record.Region)
+	}
+
+	// Records of the database are not modified by overrides.
+	record = DefaultQuery{}
+	if err = db.Lookup(net.ParseIP("8.8.8.200"), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" || record.Country.Names["en"] != "United States" {
+		t.Fatalf("Unexpected country: %+v", record.Country)
+	}
+	if len(record.Region) != 1 || record.Region[0].ISOCode != "CA" || record.Region[0].Names["en"] != "California" {
+		t.Fatalf("Unexpected region: %+v", record.Region)
+	}
+
+	// Networks not in the database are found in the overlay.
+	city, err := db.LookupCity(net.ParseIP("10.1.2.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !city.Found || city.Network.String() != "10.0.0.0/8" {
+		t.Fatalf("Unexpected network: %s, found %v", city.Network, city.Found)
+	}
+	if city.Country.ISOCode != "US" || city.Location.TimeZone != "America/New_York" {
+		t.Fatalf("Unexpected record: %+v", city)
+	}
+	city, err = db.LookupCity(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if city.Network.String() != "8.8.8.0/25" || city.Country.ISOCode != "BR" {
+		t.Fatalf("Unexpected record: %s %+v", city.Network, city.Country)
+	}
+
+	// Generic results are overridden too.
+	var generic map[string]interface{}
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &generic); err != nil {
+		t.Fatal(err)
+	}
+	country := generic["country"].(map[string]interface{})
+	if country["iso_code"] != "BR" {
+		t.Fatalf("Unexpected country: %v", country)
+	}
+}
+
+func TestOverlayCSV(t *testing.T) {
+	file, dir := writeOverlay(t, "overlay.csv", "network,country,latitude,longitude\n"+
+		"# Office\n"+
+		"200.1.2.0/28,AR,-34.6,-58.4\n")
+	defer os.RemoveAll(dir)
+	db, err := Open(testFile, Overlay(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var record DefaultQuery
+	if err = db.Lookup(net.ParseIP("200.1.2.3"), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "AR" || record.Location.Latitude != -34.6 || record.Location.Longitude != -58.4 {
+		t.Fatalf("Unexpected record: %+v", record)
+	}
+	if record.City.Names["en"] != "Caracas" {
+		t.Fatalf("Unexpected city: %+v", record.City)
+	}
+}
+
+func TestOverlayErrors(t *testing.T) {
+	for i, test := range []struct{ Name, Content string }{
+		{"overlay.yaml", "- network: 10.0.0.0\n  country: US\n"},
+		{"overlay.yaml", "network: 10.0.0.0/8\n"},
+		{"overlay.csv", "network,continent\n10.0.0.0/8,NA\n"},
+		{"overlay.csv", "network,latitude\n10.0.0.0/8,north\n"},
+		{"overlay.json", "[]"},
+	} {
+		file, dir := writeOverlay(t, test.Name, test.Content)
+		db, err := Open(testFile, Overlay(file))
+		if err == nil {
+			db.Close()
+			t.Errorf("Test %d: unexpected overlay was loaded", i)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOverlayReload(t *testing.T) {
+	file, dir := writeOverlay(t, "overlay.yaml", testOverlayYAML)
+	defer os.RemoveAll(dir)
+	db, err := Open(testFile, Overlay(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = ioutil.WriteFile(file, []byte("- network: 8.8.8.0/24\n  country: MX\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		var record DefaultQuery
+		if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Country.ISOCode == "MX" {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatal("Overlay was not reloaded")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
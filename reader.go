@@ -0,0 +1,130 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// refShards is the number of reference counters of readers. Lookups
+// count their reference in the counter of their address, so concurrent
+// lookups of different addresses don't contend on the same cache line.
+const refShards = 16
+
+// refCounter is a reference counter in a cache line of its own.
+type refCounter struct {
+	n int32
+	_ [60]byte
+}
+
+// refReader is a reference counted database reader. Lookups hold a
+// reference until they're done, and the DB releases the reader when
+// it's replaced, so replaced readers are only closed after in-flight
+// lookups drain.
+type refReader struct {
+	*maxminddb.Reader
+	langs *languageMatcher
+
+	refs     [refShards]refCounter // References of lookups, by shard.
+	released int32                 // Set when released by the DB.
+	closed   int32                 // Set when the reader is closed.
+}
+
+func newRefReader(reader *maxminddb.Reader) *refReader {
+	return &refReader{
+		Reader: reader,
+		langs:  newLanguageMatcher(reader.Metadata.Languages),
+	}
+}
+
+// refShard returns the shard of the reference counter of lookups of
+// the address. Lookups without an address use the first one.
+func refShard(addr net.IP) int {
+	if len(addr) == 0 {
+		return 0
+	}
+	return int(addr[len(addr)-1]) % refShards
+}
+
+// acquire adds a reference to the reader for a lookup of addr, unless
+// the reader was released by the DB already.
+func (r *refReader) acquire(addr net.IP) bool {
+	c := &r.refs[refShard(addr)]
+	atomic.AddInt32(&c.n, 1)
+	// The DB sets released before counting references, so either it
+	// counts this one or it's seen here.
+	if atomic.LoadInt32(&r.released) == 0 {
+		return true
+	}
+	r.release(addr)
+	return false
+}
+
+// release drops the reference of a lookup of addr, and closes the
+// reader if it was released by the DB and that was the last one.
+func (r *refReader) release(addr net.IP) {
+	atomic.AddInt32(&r.refs[refShard(addr)].n, -1)
+	if atomic.LoadInt32(&r.released) != 0 {
+		r.closeIfDrained()
+	}
+}
+
+// drain releases the reader on behalf of the DB, and closes it once
+// in-flight lookups drain.
+func (r *refReader) drain() {
+	atomic.StoreInt32(&r.released, 1)
+	r.closeIfDrained()
+}
+
+// count returns the number of references of lookups.
+func (r *refReader) count() int32 {
+	var n int32
+	for i := range r.refs {
+		n += atomic.LoadInt32(&r.refs[i].n)
+	}
+	return n
+}
+
+func (r *refReader) closeIfDrained() {
+	if r.count() == 0 && atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		r.Reader.Close()
+	}
+}
+
+// current returns the reader in use by the DB, or nil.
+func (db *DB) current() *refReader {
+	r, _ := db.reader.Load().(*refReader)
+	return r
+}
+
+// acquire returns the reader in use by the DB with a reference for a
+// lookup of addr, that must be released with the same address, or nil
+// if no database is loaded. Lookups use it without locking the DB.
+func (db *DB) acquire(addr net.IP) *refReader {
+	for {
+		r := db.current()
+		if r == nil || r.acquire(addr) {
+			return r
+		}
+		// The reader was replaced meanwhile, try again.
+	}
+}
+
+// swapReader replaces the reader in use by the DB, and releases the
+// previous one. Must be called with db.mu locked.
+func (db *DB) swapReader(reader *maxminddb.Reader) {
+	var next *refReader
+	if reader != nil {
+		next = newRefReader(reader)
+	}
+	prev := db.current()
+	db.reader.Store(next)
+	if prev != nil {
+		prev.drain()
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+func TestRefReader(t *testing.T) {
+	db, err := Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	addr := net.ParseIP("8.8.8.8")
+	r := db.acquire(addr)
+	if r == nil {
+		t.Fatal("No reader")
+	}
+	next, checksum, err := db.newReader(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.setReader(next, time.Now(), checksum, "")
+	if db.current() == r {
+		t.Fatal("Reader was not replaced")
+	}
+	if n := r.count(); n != 1 || r.closed != 0 {
+		t.Fatalf("Unexpected refs: want 1, have %d (closed %d)", n, r.closed)
+	}
+	var record DefaultQuery
+	if err = r.Lookup(addr, &record); err != nil {
+		t.Fatal(err)
+	}
+	r.release(addr)
+	if n := r.count(); n != 0 || r.closed != 1 {
+		t.Fatalf("Unexpected refs: want 0, have %d (closed %d)", n, r.closed)
+	}
+	if r.acquire(addr) {
+		t.Fatal("Drained reader was acquired")
+	}
+	db.Close()
+	if db.acquire(addr) != nil {
+		t.Fatal("Closed db has a reader")
+	}
+}
+
+func TestRefShard(t *testing.T) {
+	shards := make(map[int]bool)
+	for i := 0; i < 256; i++ {
+		shards[refShard(net.IPv4(8, 8, 8, byte(i)))] = true
+	}
+	if len(shards) != refShards {
+		t.Fatalf("Unexpected shards of addresses: want %d, have %d", refShards, len(shards))
+	}
+	if refShard(nil) != 0 {
+		t.Fatal("Unexpected shard of lookups without address")
+	}
+}
+
+func TestLookupDuringReload(t *testing.T) {
+	// Lookups on memory-mapped readers that were closed would crash.
+	db, err := Open(testFile, MemoryMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mapped := db.cache.mappedFile(testFile)
+	defer os.Remove(mappedInfoFile(mapped))
+	defer os.Remove(mapped)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var record DefaultQuery
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				err := db.Lookup(net.ParseIP("8.8.8.8"), &record)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		reader, checksum, err := db.newReader(db.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.setReader(reader, time.Now(), checksum, "")
+	}
+	close(done)
+	wg.Wait()
+}
+
+// rwMutexDB is the previous design of DB lookups, where readers are
+// protected by a sync.RWMutex, for comparison in benchmarks.
+type rwMutexDB struct {
+	mu     sync.RWMutex
+	reader *maxminddb.Reader
+}
+
+func (db *rwMutexDB) Lookup(addr net.IP, result interface{}) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.reader != nil {
+		return db.reader.Lookup(addr, result)
+	}
+	return ErrUnavailable
+}
+
+type lookuper interface {
+	Lookup(addr net.IP, result interface{}) error
+}
+
+// benchmarkAddrs are the addresses of benchmarks, in one network of
+// the test database, as lookups of clients of a busy server.
+var benchmarkAddrs = func() []net.IP {
+	addrs := make([]net.IP, 256)
+	for i := range addrs {
+		addrs[i] = net.IPv4(8, 8, 8, byte(i))
+	}
+	return addrs
+}()
+
+func benchmarkLookup(b *testing.B, db lookuper, reload func()) {
+	if reload != nil {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		defer func() {
+			close(done)
+			<-stopped // No reloads after the benchmark.
+		}()
+		go func() {
+			defer close(stopped)
+			tick := time.NewTicker(time.Millisecond)
+			defer tick.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-tick.C:
+					reload()
+				}
+			}
+		}()
+	}
+	var next uint32
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var record struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		// Each goroutine looks up addresses from a different one.
+		i := int(atomic.AddUint32(&next, 37))
+		for pb.Next() {
+			i++
+			if err := db.Lookup(benchmarkAddrs[i%len(benchmarkAddrs)], &record); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// benchmarkData returns the test database, for creating readers in
+// benchmarks without reading the file again.
+func benchmarkData(b *testing.B) []byte {
+	f, err := os.Open(testFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	data, err := readDatabase(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// benchmarkDB returns a DB and a function that replaces its reader, as
+// reloads do.
+func benchmarkDB(b *testing.B) (*DB, func()) {
+	db, err := Open(testFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := benchmarkData(b)
+	reload := func() {
+		reader, err := maxminddb.FromBytes(data)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		db.mu.Lock()
+		db.swapReader(reader)
+		db.mu.Unlock()
+	}
+	return db, reload
+}
+
+func benchmarkRWMutexDB(b *testing.B) (*rwMutexDB, func()) {
+	data := benchmarkData(b)
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rw := &rwMutexDB{reader: reader}
+	reload := func() {
+		reader, err := maxminddb.FromBytes(data)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		rw.mu.Lock()
+		prev := rw.reader
+		rw.reader = reader
+		rw.mu.Unlock()
+		prev.Close()
+	}
+	return rw, reload
+}
+
+// Run with e.g. go test -run NONE -bench Lookup -cpu 1,4,16.
+
+func BenchmarkLookup(b *testing.B) {
+	db, _ := benchmarkDB(b)
+	defer db.Close()
+	benchmarkLookup(b, db, nil)
+}
+
+func BenchmarkLookupRWMutex(b *testing.B) {
+	db, _ := benchmarkRWMutexDB(b)
+	defer db.reader.Close()
+	benchmarkLookup(b, db, nil)
+}
+
+func BenchmarkLookupReload(b *testing.B) {
+	db, reload := benchmarkDB(b)
+	defer db.Close()
+	benchmarkLookup(b, db, reload)
+}
+
+func BenchmarkLookupReloadRWMutex(b *testing.B) {
+	db, reload := benchmarkRWMutexDB(b)
+	defer db.reader.Close()
+	benchmarkLookup(b, db, reload)
+}
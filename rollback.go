@@ -0,0 +1,128 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNoBackup is returned by DB.Rollback when there is no previous
+// version of the database to roll back to.
+var ErrNoBackup = errors.New("no previous database version")
+
+// ErrNoSource is returned by DB.Rollback for databases that are not
+// opened from a source, as their files are managed by their users.
+var ErrNoSource = errors.New("database is not opened from a source")
+
+// versions returns the number of previous versions of the database
+// file to keep.
+func (db *DB) versions() int {
+	if db.keepVersions < 1 {
+		return 1
+	}
+	return db.keepVersions
+}
+
+// backupFile returns the name of the nth previous version of the
+// database file, 1 being the most recent: db.gz.bak, db.gz.bak.2, etc.
+func (db *DB) backupFile(n int) string {
+	if n == 1 {
+		return db.file + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", db.file, n)
+}
+
+// rotateBackups moves the database file to the most recent backup,
+// shifting older backups and dropping the oldest one. Backups are not
+// rotated if there's no database file yet, so they have no gaps.
+func (db *DB) rotateBackups() {
+	if _, err := os.Stat(db.file); err != nil {
+		return
+	}
+	// All optional, might fail.
+	for n := db.versions() - 1; n > 0; n-- {
+		os.Rename(db.backupFile(n), db.backupFile(n+1))
+	}
+	os.Rename(db.file, db.backupFile(1))
+}
+
+// Rollback reverts the database file to the previous version and loads
+// it. The number of previous versions available is set by the
+// KeepVersions option.
+//
+// The current version is discarded, and DBs that point to a URL won't
+// install it again if the update returns the same file. Only DBs
+// opened from a source can be rolled back, others return ErrNoSource.
+func (db *DB) Rollback() error {
+	if db.source == "" {
+		return ErrNoSource
+	}
+	unlock, err := lock(lockFile(db.file))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	db.updateMu.Lock()
+	defer db.updateMu.Unlock()
+	return db.rollback()
+}
+
+func (db *DB) rollback() error {
+	if _, err := os.Stat(db.backupFile(1)); err != nil {
+		return ErrNoBackup
+	}
+	if checksum, err := fileSHA256(db.file); err == nil {
+		db.reject(checksum)
+	}
+	if err := os.Rename(db.backupFile(1), db.file); err != nil {
+		return err
+	}
+	for n := 2; n <= db.versions(); n++ {
+		os.Rename(db.backupFile(n), db.backupFile(n-1)) // Optional, might fail.
+	}
+	if err := db.loadFile(true); err != nil {
+		return fmt.Errorf("failed to load previous version: %s", err)
+	}
+	db.sendInfo("rolled back to the previous version")
+	db.publish(Event{Type: EventRollback})
+	return nil
+}
+
+// reject marks the database file with the given SHA-256 checksum as
+// rejected, so it is not installed again by updates.
+func (db *DB) reject(checksum string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.rejected == nil {
+		db.rejected = make(map[string]bool)
+	}
+	db.rejected[checksum] = true
+}
+
+// isRejected returns true if the given SHA-256 checksum belongs to a
+// database file that has been rolled back.
+func (db *DB) isRejected(checksum string) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.rejected[checksum]
+}
+
+// isRejectedFile returns true if the given file is a database file
+// that has been rolled back.
+func (db *DB) isRejectedFile(name string) (bool, error) {
+	db.mu.RLock()
+	n := len(db.rejected)
+	db.mu.RUnlock()
+	if n == 0 {
+		return false, nil
+	}
+	checksum, err := fileSHA256(name)
+	if err != nil {
+		return false, err
+	}
+	return db.isRejected(checksum), nil
+}
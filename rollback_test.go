@@ -0,0 +1,214 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newRollbackDB returns a DB with no database loaded yet, using a
+// database file in a temporary directory.
+func newRollbackDB(t *testing.T, opts ...Option) (db *DB, dir string) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = newPendingDB()
+	db.file = filepath.Join(dir, "db.gz")
+	db.source = "test"
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db, dir
+}
+
+func TestRotateBackups(t *testing.T) {
+	db, dir := newRollbackDB(t, KeepVersions(3))
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	for i := 1; i <= 5; i++ {
+		name := filepath.Join(dir, "new")
+		err := ioutil.WriteFile(name, []byte(strconv.Itoa(i)), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.renameFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, want := range map[string]string{
+		db.file:          "5",
+		db.backupFile(1): "4",
+		db.backupFile(2): "3",
+		db.backupFile(3): "2",
+	} {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Fatalf("Unexpected contents of %s: want %q, have %q", file, want, b)
+		}
+	}
+	if _, err := os.Stat(db.backupFile(4)); err == nil {
+		t.Fatal("Unexpected backup was kept:", db.backupFile(4))
+	}
+}
+
+func TestRotateBackupsMissingFile(t *testing.T) {
+	db, dir := newRollbackDB(t, KeepVersions(3))
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	if err := ioutil.WriteFile(db.backupFile(1), []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db.rotateBackups()
+	if _, err := os.Stat(db.backupFile(1)); err != nil {
+		t.Fatal("Unexpected rotation of backups without database file:", err)
+	}
+	if _, err := os.Stat(db.backupFile(2)); err == nil {
+		t.Fatal("Unexpected backup:", db.backupFile(2))
+	}
+}
+
+func TestRollbackNoSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "db.gz")
+	for _, name := range []string{file, file + ".bak"} {
+		if err = ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = db.Rollback(); err != ErrNoSource {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = os.Stat(file + ".bak"); err != nil {
+		t.Fatal("Unexpected rollback of local file:", err)
+	}
+}
+
+func TestRollbackLoadFailure(t *testing.T) {
+	db, dir := newRollbackDB(t)
+	defer os.RemoveAll(dir)
+	sub := db.Subscribe()
+	if err := ioutil.WriteFile(db.backupFile(1), []byte("bogus"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(db.file, []byte("bogus"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rollback(); err == nil {
+		t.Fatal("Unexpected rollback to invalid database worked")
+	}
+	db.Close()
+	for ev := range sub.Events() {
+		if ev.Type == EventRollback {
+			t.Fatal("Unexpected rollback event")
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db, dir := newRollbackDB(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	if err := db.Rollback(); err != ErrNoBackup {
+		t.Fatal("Unexpected error:", err)
+	}
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(db.backupFile(1), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(db.file, []byte("bogus"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := fileSHA256(db.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if !db.isRejected(checksum) {
+		t.Fatal("Rolled back version was not rejected")
+	}
+	if _, err = os.Stat(db.backupFile(1)); err == nil {
+		t.Fatal("Unexpected backup was kept after rollback")
+	}
+	var record DefaultQuery
+	err = db.Lookup(net.ParseIP("8.8.8.8"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+}
+
+func TestRollbackOnUpdate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("bogus"))
+	}))
+	defer srv.Close()
+	db, dir := newRollbackDB(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(db.file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.openFile(); err != nil {
+		t.Fatal(err)
+	}
+	err = db.runUpdate(&HTTPSource{URL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatal("Unexpected error:", err)
+	}
+	for i := 0; i < 2; i++ {
+		b, err := ioutil.ReadFile(db.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatal("Database file was not rolled back")
+		}
+		// The rejected version is not installed again.
+		if err = db.runUpdate(&HTTPSource{URL: srv.URL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var record DefaultQuery
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the hex encoded SHA-256 digest of an empty payload.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Source is a Source of database files stored in Amazon S3 or an
+// S3-compatible object store, e.g. MinIO. Requests use path-style URLs,
+// and are signed with AWS Signature Version 4 when credentials are set.
+//
+// New versions are checked for with conditional requests using the
+// ETag of the object, as with HTTPSource.
+type S3Source struct {
+	Endpoint        string       // e.g. https://s3.amazonaws.com or http://localhost:9000.
+	Region          string       // e.g. us-east-1, the default.
+	Bucket          string       // Name of the bucket.
+	Key             string       // Key of the database object.
+	AccessKeyID     string       // Access key, or empty for public objects.
+	SecretAccessKey string       // Secret of the access key.
+	Client          *http.Client // Client for requests, http.DefaultClient if nil.
+}
+
+// Check implements the Source interface.
+func (s *S3Source) Check(cur *Version) (bool, error) {
+	return s.http().Check(cur)
+}
+
+// Fetch implements the Source interface.
+func (s *S3Source) Fetch(w io.Writer, cur *Version) (*Version, error) {
+	return s.http().Fetch(w, cur)
+}
+
+func (s *S3Source) String() string {
+	return s.url()
+}
+
+// url returns the path-style URL of the database object.
+func (s *S3Source) url() string {
+	segments := strings.Split(s.Key, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.TrimRight(s.Endpoint, "/") + "/" +
+		awsEscape(s.Bucket) + "/" + strings.Join(segments, "/")
+}
+
+// http returns an HTTPSource for the database object.
+func (s *S3Source) http() *HTTPSource {
+	return &HTTPSource{URL: s.url(), Client: s.Client, prepare: s.sign}
+}
+
+// sign signs requests to the object store, when credentials are set.
+func (s *S3Source) sign(req *http.Request) error {
+	if s.AccessKeyID == "" {
+		return nil
+	}
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	signV4(req, "s3", region, s.AccessKeyID, s.SecretAccessKey, emptySHA256, time.Now())
+	return nil
+}
+
+// signV4 signs the request with AWS Signature Version 4 for the given
+// service and region, using the host and x-amz-* headers of the request.
+// The payload hash is the hex encoded SHA-256 digest of the body.
+func signV4(req *http.Request, service, region, accessKeyID, secretAccessKey, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzdate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzdate)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzdate + "\n" + scope + "\n" +
+		sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query string of a canonical request.
+func canonicalQuery(q url.Values) string {
+	var params []string
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsEscape escapes s as required by AWS Signature Version 4, where
+// only unreserved characters are left unescaped.
+func awsEscape(s string) string {
+	const hexdigits = "0123456789ABCDEF"
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b = append(b, c)
+		default:
+			b = append(b, '%', hexdigits[c>>4], hexdigits[c&15])
+		}
+	}
+	return string(b)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	io.WriteString(h, data)
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla example of the AWS Signature Version 4 test suite.
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signV4(req, "service", "us-east-1",
+		"AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", emptySHA256,
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if have := req.Header.Get("Authorization"); have != want {
+		t.Fatalf("Unexpected signature:\nwant %q\nhave %q", want, have)
+	}
+}
+
+func TestS3SourceURL(t *testing.T) {
+	s := &S3Source{
+		Endpoint: "http://localhost:9000/",
+		Bucket:   "geoip",
+		Key:      "maxmind/GeoLite2 City+.tar.gz",
+	}
+	want := "http://localhost:9000/geoip/maxmind/GeoLite2%20City%2B.tar.gz"
+	if have := s.String(); have != want {
+		t.Fatalf("Unexpected URL: want %q, have %q", want, have)
+	}
+}
+
+// s3Server is a stand-in for an S3-compatible object store serving the
+// test database, e.g. MinIO.
+type s3Server struct {
+	*httptest.Server
+	data     []byte
+	requests int
+}
+
+func newS3Server(t *testing.T) *s3Server {
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := &s3Server{data: data}
+	ss.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ss.requests++
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") ||
+			!strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+			r.Header.Get("X-Amz-Content-Sha256") != emptySHA256 {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/geoip/GeoLite2-City.mmdb.gz" {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(ss.data))
+	}))
+	return ss
+}
+
+func TestS3SourceFetch(t *testing.T) {
+	ss := newS3Server(t)
+	defer ss.Close()
+	src := &S3Source{
+		Endpoint:        ss.URL,
+		Bucket:          "geoip",
+		Key:             "GeoLite2-City.mmdb.gz",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+	}
+	var b bytes.Buffer
+	v, err := src.Fetch(&b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), ss.data) {
+		t.Fatal("Unexpected database contents")
+	}
+	if v.ETag == "" || v.Size != int64(len(ss.data)) {
+		t.Fatalf("Unexpected version: %+v", v)
+	}
+	if _, err = src.Fetch(ioutil.Discard, v); err != ErrNotModified {
+		t.Fatal("Unexpected error:", err)
+	}
+	src.SecretAccessKey = ""
+	src.AccessKeyID = ""
+	if _, err = src.Fetch(ioutil.Discard, nil); err == nil {
+		t.Fatal("Unexpected unsigned request worked")
+	}
+}
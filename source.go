@@ -0,0 +1,234 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotModified is returned by Source.Fetch when the source has the
+// same version of the database as the local copy.
+var ErrNotModified = errors.New("database not modified")
+
+// Source is a source of database files for DBs that update
+// automatically, e.g. an HTTP server, a local directory, or an
+// S3-compatible object store. See OpenSource.
+type Source interface {
+	// Check returns true if the source might have a version of the
+	// database other than cur, the version of the local copy. The cur
+	// version is nil when there's no local copy.
+	//
+	// Sources that can check for new versions as part of Fetch, e.g.
+	// using conditional requests, may return true without checking.
+	Check(cur *Version) (bool, error)
+
+	// Fetch writes the database file to w, and returns its version.
+	// If cur is not nil and the source has the same version, Fetch
+	// returns ErrNotModified without writing to w.
+	Fetch(w io.Writer, cur *Version) (*Version, error)
+
+	// String returns the location of the database file in the source,
+	// e.g. its URL. It identifies the source of local copies, and
+	// might contain secrets such as license keys.
+	String() string
+}
+
+// Version describes a version of a database file in a Source. Sources
+// set the fields they know of.
+type Version struct {
+	ETag         string    `json:"etag,omitempty"` // Opaque version id, e.g. HTTP ETag.
+	LastModified time.Time `json:"last_modified"`  // Modification time.
+	Size         int64     `json:"size"`           // Size of the file, -1 if unknown.
+	MD5          string    `json:"-"`              // MD5 of the uncompressed database.
+}
+
+// HTTPSource is a Source of database files served over HTTP.
+//
+// It checks for new versions with conditional requests using the ETag
+// and Last-Modified headers of the previous download. When those are
+// not available, it compares the Content-Length or the X-Database-MD5
+// headers of a HEAD request with the local copy.
+type HTTPSource struct {
+	URL    string       // URL of the database file.
+	Client *http.Client // Client for requests, http.DefaultClient if nil.
+
+	prepare func(req *http.Request) error // Prepares requests, e.g. signs them.
+}
+
+// Check implements the Source interface.
+func (s *HTTPSource) Check(cur *Version) (bool, error) {
+	if cur == nil {
+		return true, nil // Local db is missing, must be downloaded.
+	}
+	if cur.ETag != "" || !cur.LastModified.IsZero() {
+		return true, nil // Checked by the conditional request of Fetch.
+	}
+	resp, err := s.do("HEAD", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	// Check X-Database-MD5 if it exists
+	headerMd5 := resp.Header.Get("X-Database-MD5")
+	if len(headerMd5) > 0 && cur.MD5 != headerMd5 {
+		return true, nil
+	}
+
+	if cur.Size != resp.ContentLength {
+		return true, nil
+	}
+	return false, nil
+}
+
+// Fetch implements the Source interface.
+func (s *HTTPSource) Fetch(w io.Writer, cur *Version) (*Version, error) {
+	resp, err := s.do("GET", cur)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cur != nil:
+		return nil, ErrNotModified
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	v := &Version{
+		ETag: resp.Header.Get("ETag"),
+		Size: resp.ContentLength,
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		v.LastModified, _ = http.ParseTime(lm)
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	v.Size = n
+	return v, nil
+}
+
+// do sends a request to the source URL, made conditional on cur not
+// being modified when cur is not nil.
+func (s *HTTPSource) do(method string, cur *Version) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cur != nil && cur.ETag != "" {
+		req.Header.Set("If-None-Match", cur.ETag)
+	}
+	if cur != nil && !cur.LastModified.IsZero() {
+		req.Header.Set("If-Modified-Since", cur.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if s.prepare != nil {
+		if err = s.prepare(req); err != nil {
+			return nil, err
+		}
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	return resp, redactError(err)
+}
+
+func (s *HTTPSource) String() string {
+	return s.URL
+}
+
+// DirSource is a Source of database files in a local directory, e.g. a
+// mounted volume that is updated by another process. The most recently
+// modified file in the directory that matches the pattern is used.
+type DirSource struct {
+	Dir     string // Directory of the database files.
+	Pattern string // Pattern of file names as in filepath.Match, or all.
+}
+
+// Check implements the Source interface.
+func (s *DirSource) Check(cur *Version) (bool, error) {
+	_, next, err := s.latest()
+	if err != nil {
+		return false, err
+	}
+	return !next.same(cur), nil
+}
+
+// Fetch implements the Source interface.
+func (s *DirSource) Fetch(w io.Writer, cur *Version) (*Version, error) {
+	name, v, err := s.latest()
+	if err != nil {
+		return nil, err
+	}
+	if v.same(cur) {
+		return nil, ErrNotModified
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err = io.Copy(w, f); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// latest returns the name and version of the most recently modified
+// database file in the directory.
+func (s *DirSource) latest() (string, *Version, error) {
+	pattern := s.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+	names, err := filepath.Glob(filepath.Join(s.Dir, pattern))
+	if err != nil {
+		return "", nil, err
+	}
+	var name string
+	var latest os.FileInfo
+	for _, n := range names {
+		stat, err := os.Stat(n)
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+		if latest == nil || stat.ModTime().After(latest.ModTime()) {
+			name, latest = n, stat
+		}
+	}
+	if latest == nil {
+		return "", nil, fmt.Errorf("no database file in %s", s.Dir)
+	}
+	v := &Version{
+		ETag:         latest.Name(),
+		LastModified: latest.ModTime().UTC(),
+		Size:         latest.Size(),
+	}
+	return name, v, nil
+}
+
+func (s *DirSource) String() string {
+	return filepath.Join(s.Dir, s.Pattern)
+}
+
+// same returns true if v is the same version of the file as cur, which
+// might only have the size of the local copy.
+func (v *Version) same(cur *Version) bool {
+	switch {
+	case cur == nil:
+		return false
+	case cur.ETag == "" && cur.LastModified.IsZero():
+		return v.Size == cur.Size
+	}
+	return v.ETag == cur.ETag && v.LastModified.Equal(cur.LastModified) && v.Size == cur.Size
+}
@@ -0,0 +1,114 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := &DirSource{Dir: dir, Pattern: "*.mmdb"}
+	if _, err = src.Check(nil); err == nil {
+		t.Fatal("Unexpected database in empty directory")
+	}
+	now := time.Now()
+	for i, name := range []string{"b.mmdb", "a.mmdb", "c.txt"} {
+		file := filepath.Join(dir, name)
+		if err = ioutil.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modtime := now.Add(time.Duration(i) * time.Hour)
+		if err = os.Chtimes(file, modtime, modtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := ioutil.TempFile(dir, "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	v, err := src.Fetch(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ETag != "a.mmdb" {
+		t.Fatal("Unexpected database file:", v.ETag)
+	}
+	if yes, err := src.Check(v); err != nil || yes {
+		t.Fatalf("Unexpected check result: %v, %v", yes, err)
+	}
+	if _, err = src.Fetch(f, v); err != ErrNotModified {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestOpenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "GeoLite2-City.mmdb.gz"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheDir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	m := NewManager()
+	defer m.Close()
+	db, err := m.OpenSource("test-source", &DirSource{Dir: dir}, time.Hour, time.Minute, Cache(CacheOptions{Dir: cacheDir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-db.NotifyOpen():
+	case err := <-db.NotifyError():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out")
+	}
+	var record DefaultQuery
+	err = db.Lookup(net.ParseIP("8.8.8.8"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Country.ISOCode != "US" {
+		t.Fatal("Unexpected ISO code:", record.Country.ISOCode)
+	}
+}
+
+func TestHTTPSourceRedactError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // Downloads fail to connect.
+	u := srv.URL + "/geoip_download?edition_id=GeoLite2-City&license_key=secret"
+	_, err := (&HTTPSource{URL: u}).Fetch(ioutil.Discard, nil)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatal("Unexpected error:", err)
+	}
+	_, err = fetchSHA256(u + "&suffix=tar.gz.sha256")
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
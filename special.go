@@ -0,0 +1,104 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net"
+	"sort"
+)
+
+// SpecialPurpose is an address block of the IANA IPv4 and IPv6
+// special-purpose address registries (RFC 6890), or a multicast block,
+// that is not globally reachable. Such addresses have no location, and
+// are not in databases.
+type SpecialPurpose struct {
+	Network *net.IPNet
+	Name    string // Name in the registry, e.g. Private-Use.
+
+	// Scope of the addresses: unspecified, loopback, private, shared,
+	// link-local, documentation, benchmarking, multicast, broadcast or
+	// reserved.
+	Scope string
+}
+
+// specialPurposeBlocks are the special-purpose blocks by prefix length,
+// longest first. Blocks with an empty scope are globally reachable
+// blocks within other blocks, e.g. AS112 and Teredo.
+var specialPurposeBlocks = newSpecialPurposeBlocks([][3]string{
+	// IPv4, iana.org/assignments/iana-ipv4-special-registry.
+	{"0.0.0.0/8", "This network", "unspecified"},
+	{"10.0.0.0/8", "Private-Use", "private"},
+	{"100.64.0.0/10", "Shared Address Space", "shared"},
+	{"127.0.0.0/8", "Loopback", "loopback"},
+	{"169.254.0.0/16", "Link Local", "link-local"},
+	{"172.16.0.0/12", "Private-Use", "private"},
+	{"192.0.0.0/24", "IETF Protocol Assignments", "reserved"},
+	{"192.0.0.9/32", "Port Control Protocol Anycast", ""},
+	{"192.0.0.10/32", "Traversal Using Relays around NAT Anycast", ""},
+	{"192.0.2.0/24", "Documentation (TEST-NET-1)", "documentation"},
+	{"192.88.99.0/24", "Deprecated (6to4 Relay Anycast)", "reserved"},
+	{"192.168.0.0/16", "Private-Use", "private"},
+	{"198.18.0.0/15", "Benchmarking", "benchmarking"},
+	{"198.51.100.0/24", "Documentation (TEST-NET-2)", "documentation"},
+	{"203.0.113.0/24", "Documentation (TEST-NET-3)", "documentation"},
+	{"224.0.0.0/4", "Multicast", "multicast"},
+	{"240.0.0.0/4", "Reserved", "reserved"},
+	{"255.255.255.255/32", "Limited Broadcast", "broadcast"},
+
+	// IPv6, iana.org/assignments/iana-ipv6-special-registry.
+	// IPv4-mapped addresses are looked up as IPv4.
+	{"::/128", "Unspecified Address", "unspecified"},
+	{"::1/128", "Loopback Address", "loopback"},
+	{"64:ff9b:1::/48", "IPv4-IPv6 Translation (local use)", "private"},
+	{"100::/64", "Discard-Only Address Block", "reserved"},
+	{"2001::/23", "IETF Protocol Assignments", "reserved"},
+	{"2001::/32", "TEREDO", ""},
+	{"2001:1::1/128", "Port Control Protocol Anycast", ""},
+	{"2001:1::2/128", "Traversal Using Relays around NAT Anycast", ""},
+	{"2001:2::/48", "Benchmarking", "benchmarking"},
+	{"2001:3::/32", "AMT", ""},
+	{"2001:4:112::/48", "AS112-v6", ""},
+	{"2001:20::/28", "ORCHIDv2", ""},
+	{"2001:db8::/32", "Documentation", "documentation"},
+	{"3fff::/20", "Documentation", "documentation"},
+	{"fc00::/7", "Unique-Local", "private"},
+	{"fe80::/10", "Link-Local Unicast", "link-local"},
+	{"ff00::/8", "Multicast", "multicast"},
+})
+
+func newSpecialPurposeBlocks(table [][3]string) []*SpecialPurpose {
+	blocks := make([]*SpecialPurpose, len(table))
+	for i, row := range table {
+		_, network, err := net.ParseCIDR(row[0])
+		if err != nil {
+			panic(err)
+		}
+		blocks[i] = &SpecialPurpose{Network: network, Name: row[1], Scope: row[2]}
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		ni, _ := blocks[i].Network.Mask.Size()
+		nj, _ := blocks[j].Network.Mask.Size()
+		return ni > nj
+	})
+	return blocks
+}
+
+// LookupSpecialPurpose returns the special-purpose block of the IP
+// address, e.g. Private-Use for 10.0.0.1 or Loopback Address for ::1,
+// or nil if the address is globally reachable.
+func LookupSpecialPurpose(addr net.IP) *SpecialPurpose {
+	if ip := addr.To4(); ip != nil {
+		addr = ip
+	}
+	for _, b := range specialPurposeBlocks {
+		if len(b.Network.IP) == len(addr) && b.Network.Contains(addr) {
+			if b.Scope == "" {
+				return nil
+			}
+			return b
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net"
+	"testing"
+)
+
+func TestLookupSpecialPurpose(t *testing.T) {
+	for _, test := range []struct {
+		IP, Scope string
+	}{
+		{"10.0.0.1", "private"},
+		{"172.31.255.255", "private"},
+		{"192.168.1.1", "private"},
+		{"::ffff:192.168.1.1", "private"},
+		{"fd00::1", "private"},
+		{"127.0.0.1", "loopback"},
+		{"::1", "loopback"},
+		{"::", "unspecified"},
+		{"100.64.0.1", "shared"},
+		{"169.254.169.254", "link-local"},
+		{"fe80::1", "link-local"},
+		{"192.0.2.1", "documentation"},
+		{"2001:db8::1", "documentation"},
+		{"198.19.0.1", "benchmarking"},
+		{"224.0.0.251", "multicast"},
+		{"ff02::1", "multicast"},
+		{"255.255.255.255", "broadcast"},
+		{"240.0.0.1", "reserved"},
+		{"192.0.0.1", "reserved"},
+		{"2001:10::1", "reserved"},
+
+		// Globally reachable.
+		{"8.8.8.8", ""},
+		{"172.32.0.1", ""},
+		{"192.0.0.9", ""},
+		{"2001::1", ""},
+		{"2a02:f000::1", ""},
+	} {
+		sp := LookupSpecialPurpose(net.ParseIP(test.IP))
+		scope := ""
+		if sp != nil {
+			scope = sp.Scope
+		}
+		if scope != test.Scope {
+			t.Errorf("Unexpected scope of %s: want %q, have %q", test.IP, test.Scope, scope)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ErrValidation is returned when a new database file fails validation
+// and is not loaded.
+var ErrValidation = errors.New("database validation failed")
+
+// Validation configures the checks a new database file must pass
+// before it replaces the database in use. See the Validate option.
+type Validation struct {
+	// DatabaseType is the expected type of the database, e.g.
+	// GeoLite2-City. If empty, new databases must be of the same
+	// type as the database in use.
+	DatabaseType string
+
+	// Canaries maps IP addresses to the country ISO code they are
+	// expected to resolve to, e.g. "8.8.8.8": "US".
+	Canaries map[string]string
+}
+
+// validate returns an error if the new reader does not pass the
+// validation. The current reader may be nil.
+//
+// Besides the database type and canaries, new databases must have the
+// same IP version as the current database, and must not be older
+// unless rolling back to a previous version.
+func (v *Validation) validate(cur, next *maxminddb.Reader, rollback bool) error {
+	var md *maxminddb.Metadata
+	if cur != nil {
+		md = &cur.Metadata
+	}
+	if err := v.checkMetadata(md, &next.Metadata, rollback); err != nil {
+		return fmt.Errorf("%s: %s", ErrValidation, err)
+	}
+	if err := v.checkCanaries(next); err != nil {
+		return fmt.Errorf("%s: %s", ErrValidation, err)
+	}
+	return nil
+}
+
+// checkMetadata checks the metadata of the next database against the
+// metadata of the current database, which may be nil.
+func (v *Validation) checkMetadata(cur, next *maxminddb.Metadata, rollback bool) error {
+	dbtype := v.DatabaseType
+	if dbtype == "" && cur != nil {
+		dbtype = cur.DatabaseType
+	}
+	if dbtype != "" && next.DatabaseType != dbtype {
+		return fmt.Errorf("unexpected database type: want %q, have %q",
+			dbtype, next.DatabaseType)
+	}
+	if cur == nil {
+		return nil
+	}
+	if next.IPVersion != cur.IPVersion {
+		return fmt.Errorf("unexpected ip version: want %d, have %d",
+			cur.IPVersion, next.IPVersion)
+	}
+	if next.BuildEpoch < cur.BuildEpoch && !rollback {
+		return fmt.Errorf("database is older than the current one: built on %s, current %s",
+			buildTime(next), buildTime(cur))
+	}
+	return nil
+}
+
+// checkCanaries looks up the canary IPs and checks their country.
+func (v *Validation) checkCanaries(r *maxminddb.Reader) error {
+	ips := make([]string, 0, len(v.Canaries))
+	for ip := range v.Canaries {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return fmt.Errorf("invalid canary ip: %q", ip)
+		}
+		var q struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		if err := r.Lookup(addr, &q); err != nil {
+			return fmt.Errorf("canary %s: %s", ip, err)
+		}
+		if want := v.Canaries[ip]; q.Country.ISOCode != want {
+			return fmt.Errorf("canary %s: want country %q, have %q",
+				ip, want, q.Country.ISOCode)
+		}
+	}
+	return nil
+}
+
+// buildTime returns the build time of the database as a string.
+func buildTime(md *maxminddb.Metadata) string {
+	return time.Unix(int64(md.BuildEpoch), 0).UTC().Format(time.RFC3339)
+}
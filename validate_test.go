@@ -0,0 +1,100 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+func TestValidateOpen(t *testing.T) {
+	db, err := Open(testFile, Validate(Validation{
+		Canaries: map[string]string{"8.8.8.8": "US"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	for _, v := range []Validation{
+		{Canaries: map[string]string{"8.8.8.8": "BR"}},
+		{Canaries: map[string]string{"bogus": "US"}},
+		{DatabaseType: "GeoIP2-ASN"},
+	} {
+		db, err = Open(testFile, Validate(v))
+		if err == nil {
+			db.Close()
+			t.Fatalf("Unexpected database passed validation: %+v", v)
+		}
+		if !strings.Contains(err.Error(), ErrValidation.Error()) {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+}
+
+func TestValidateReload(t *testing.T) {
+	db, err := Open(testFile, Validate(Validation{
+		Canaries: map[string]string{"8.8.8.8": "US"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	reader := db.current()
+	db.validation.Canaries["8.8.8.8"] = "BR"
+	db.checksum = "" // Reload the same file.
+	if err = db.openFile(); err == nil {
+		t.Fatal("Unexpected database passed validation")
+	}
+	if db.current() != reader {
+		t.Fatal("Unexpected database was loaded")
+	}
+	var record DefaultQuery
+	if err = db.Lookup(net.ParseIP("8.8.8.8"), &record); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	cur := &maxminddb.Metadata{
+		DatabaseType: "GeoLite2-City",
+		IPVersion:    6,
+		BuildEpoch:   1000,
+	}
+	newer := *cur
+	newer.BuildEpoch = 2000
+	older := *cur
+	older.BuildEpoch = 500
+	ipv4 := newer
+	ipv4.IPVersion = 4
+	asn := newer
+	asn.DatabaseType = "GeoLite2-ASN"
+	v := &Validation{}
+	for _, test := range []struct {
+		Cur, Next *maxminddb.Metadata
+		OK        bool
+	}{
+		{nil, cur, true},
+		{cur, cur, true},
+		{cur, &newer, true},
+		{cur, &older, false},
+		{cur, &ipv4, false},
+		{cur, &asn, false},
+	} {
+		err := v.checkMetadata(test.Cur, test.Next, false)
+		if ok := err == nil; ok != test.OK {
+			t.Fatalf("Unexpected result for %+v: %v", test.Next, err)
+		}
+	}
+	if err := v.checkMetadata(cur, &older, true); err != nil {
+		t.Fatal("Unexpected rollback failure:", err)
+	}
+	v.DatabaseType = "GeoLite2-ASN"
+	if err := v.checkMetadata(nil, cur, false); err == nil {
+		t.Fatal("Unexpected database type passed validation")
+	}
+}
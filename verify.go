@@ -0,0 +1,160 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrVerification is returned when a downloaded database file does not
+// match the expected checksum or signature.
+var ErrVerification = errors.New("database verification failed")
+
+// verifier checks the integrity of downloaded database files before
+// they replace the local copy of the database. See the SHA256,
+// SHA256URL and Signature options.
+type verifier struct {
+	sha256    string            // Expected hex encoded SHA-256 digest.
+	sha256URL string            // URL of the sha256sum style checksum file.
+	sigURL    string            // URL of the detached ed25519 signature.
+	publicKey ed25519.PublicKey // Public key for verifying signatures.
+}
+
+// checksum returns the expected SHA-256 digest of the database served
+// at url, or an empty string if it's not known. The digest is either
+// configured, or downloaded from the checksum URL. Downloads from the
+// MaxMind download endpoint use the checksum files published by
+// MaxMind by default.
+func (v *verifier) checksum(url string) (string, error) {
+	if v.sha256 != "" {
+		return strings.ToLower(v.sha256), nil
+	}
+	u := v.sha256URL
+	if u == "" {
+		u, _ = maxMindChecksumURL(url)
+	}
+	if u == "" {
+		return "", nil
+	}
+	return fetchSHA256(u)
+}
+
+// verify returns an error if the file does not match the checksum,
+// when not empty, or the signature, when configured.
+func (v *verifier) verify(name, checksum string) error {
+	if checksum != "" {
+		if err := verifySHA256(name, checksum); err != nil {
+			return err
+		}
+	}
+	if v.sigURL == "" {
+		return nil
+	}
+	// ed25519.Verify panics with keys of the wrong size.
+	if len(v.publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%s: invalid public key size: %d", ErrVerification, len(v.publicKey))
+	}
+	sig, err := fetchSignature(v.sigURL)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(v.publicKey, b, sig) {
+		return fmt.Errorf("%s: invalid signature", ErrVerification)
+	}
+	return nil
+}
+
+// fetchSHA256 downloads a checksum file in the format of sha256sum,
+// "<hexdigest>  <filename>", and returns the hex digest.
+func fetchSHA256(u string) (string, error) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return "", redactError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checksum download failed: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("invalid checksum file: %q", b)
+	}
+	digest, err := hex.DecodeString(fields[0])
+	if err != nil || len(digest) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum file: %q", b)
+	}
+	return hex.EncodeToString(digest), nil
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of the file.
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifySHA256 returns an error if the SHA-256 digest of the file does
+// not match the given hex digest.
+func verifySHA256(name, hexdigest string) error {
+	sum, err := fileSHA256(name)
+	if err != nil {
+		return err
+	}
+	if sum != strings.ToLower(hexdigest) {
+		return fmt.Errorf("%s: sha256 mismatch: want %s, have %s",
+			ErrVerification, hexdigest, sum)
+	}
+	return nil
+}
+
+// fetchSignature downloads a detached ed25519 signature, either raw or
+// base64 encoded.
+func fetchSignature(u string) ([]byte, error) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signature download failed: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == ed25519.SignatureSize {
+		return b, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid signature file")
+	}
+	return sig, nil
+}
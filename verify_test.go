@@ -0,0 +1,168 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifyServer serves the test database along with its checksum and
+// signature files.
+type verifyServer struct {
+	*httptest.Server
+	data      []byte
+	checksum  string
+	signature []byte
+	publicKey ed25519.PublicKey
+}
+
+func newVerifyServer(t *testing.T) *verifyServer {
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := &verifyServer{
+		data:      data,
+		signature: ed25519.Sign(priv, data),
+		publicKey: pub,
+	}
+	vs.checksum, err = fileSHA256(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/db.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(vs.data)
+	})
+	mux.HandleFunc("/db.gz.sha256", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  db.gz\n", vs.checksum)
+	})
+	mux.HandleFunc("/db.gz.sig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(vs.signature)
+	})
+	mux.HandleFunc("/db.gz.sig.b64", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, base64.StdEncoding.EncodeToString(vs.signature))
+	})
+	vs.Server = httptest.NewServer(mux)
+	return vs
+}
+
+// testVerifyUpdate runs an update of a new DB created with the given
+// options, and returns whether the database file was replaced.
+func testVerifyUpdate(t *testing.T, url string, opts ...Option) (bool, error) {
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := &DB{file: filepath.Join(dir, "db.gz")}
+	for _, opt := range opts {
+		opt(db)
+	}
+	err = db.runUpdate(&HTTPSource{URL: url})
+	_, staterr := os.Stat(db.file)
+	return staterr == nil, err
+}
+
+func TestVerifySHA256(t *testing.T) {
+	vs := newVerifyServer(t)
+	defer vs.Close()
+	ok, err := testVerifyUpdate(t, vs.URL+"/db.gz", SHA256(strings.ToUpper(vs.checksum)))
+	if err != nil || !ok {
+		t.Fatalf("Update failed: %v", err)
+	}
+	ok, err = testVerifyUpdate(t, vs.URL+"/db.gz", SHA256(strings.Repeat("0", 64)))
+	if err == nil || ok {
+		t.Fatal("Unexpected update with checksum mismatch worked")
+	}
+}
+
+func TestVerifySHA256URL(t *testing.T) {
+	vs := newVerifyServer(t)
+	defer vs.Close()
+	ok, err := testVerifyUpdate(t, vs.URL+"/db.gz", SHA256URL(vs.URL+"/db.gz.sha256"))
+	if err != nil || !ok {
+		t.Fatalf("Update failed: %v", err)
+	}
+	vs.data = append(vs.data, 0)
+	ok, err = testVerifyUpdate(t, vs.URL+"/db.gz", SHA256URL(vs.URL+"/db.gz.sha256"))
+	if err == nil || ok {
+		t.Fatal("Unexpected update with checksum mismatch worked")
+	}
+	ok, err = testVerifyUpdate(t, vs.URL+"/db.gz", SHA256URL(vs.URL+"/missing.sha256"))
+	if err == nil || ok {
+		t.Fatal("Unexpected update with missing checksum file worked")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	vs := newVerifyServer(t)
+	defer vs.Close()
+	for _, sig := range []string{"/db.gz.sig", "/db.gz.sig.b64"} {
+		ok, err := testVerifyUpdate(t, vs.URL+"/db.gz", Signature(vs.URL+sig, vs.publicKey))
+		if err != nil || !ok {
+			t.Fatalf("%s: update failed: %v", sig, err)
+		}
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := testVerifyUpdate(t, vs.URL+"/db.gz", Signature(vs.URL+"/db.gz.sig", pub))
+	if err == nil || ok {
+		t.Fatal("Unexpected update with invalid signature worked")
+	}
+}
+
+func TestVerifySignatureShortKey(t *testing.T) {
+	vs := newVerifyServer(t)
+	defer vs.Close()
+	ok, err := testVerifyUpdate(t, vs.URL+"/db.gz", Signature(vs.URL+"/db.gz.sig", vs.publicKey[:16]))
+	if err == nil || ok {
+		t.Fatal("Unexpected update with short public key worked")
+	}
+}
+
+func TestVerifyNotifyError(t *testing.T) {
+	vs := newVerifyServer(t)
+	defer vs.Close()
+	dir, err := ioutil.TempDir("", "freegeoip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewManager()
+	defer m.Close()
+	db, err := m.OpenURL("test-verify", vs.URL+"/db.gz", time.Hour, time.Minute,
+		Cache(CacheOptions{Dir: dir}), SHA256(strings.Repeat("0", 64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case file := <-db.NotifyOpen():
+		t.Fatal("Unexpected database loaded:", file)
+	case err := <-db.NotifyError():
+		if !strings.Contains(err.Error(), ErrVerification.Error()) {
+			t.Fatal("Unexpected error:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out")
+	}
+}
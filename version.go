@@ -0,0 +1,63 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// versionInfo is the version of a local copy of a database file, stored
+// next to it. See versionFile.
+type versionInfo struct {
+	Source string `json:"source"` // SHA-256 of Source.String, might have secrets.
+	Version
+}
+
+// versionFile returns the name of the file that stores the version of
+// the local copy of a database file.
+func versionFile(dbfile string) string {
+	return dbfile + ".version"
+}
+
+// readVersion returns the version of the local copy dbfile of the
+// database file from src, or nil if dbfile is missing or its version
+// is not known.
+func readVersion(dbfile string, src Source) *Version {
+	if _, err := os.Stat(dbfile); err != nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile(versionFile(dbfile))
+	if err != nil {
+		return nil
+	}
+	var info versionInfo
+	err = json.Unmarshal(b, &info)
+	if err != nil || info.Source != sha256Hex([]byte(src.String())) {
+		return nil
+	}
+	return &info.Version
+}
+
+// writeVersion stores the version of the local copy dbfile of the
+// database file from src. A nil version removes it.
+func writeVersion(dbfile string, src Source, v *Version) error {
+	if v == nil {
+		err := os.Remove(versionFile(dbfile))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	b, err := json.Marshal(&versionInfo{
+		Source:  sha256Hex([]byte(src.String())),
+		Version: *v,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(versionFile(dbfile), b, 0644)
+}
@@ -0,0 +1,145 @@
+// Copyright 2009 The freegeoip authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package freegeoip
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cacheServer serves the test database with cache validators, and
+// counts requests per method.
+type cacheServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	data     []byte
+	etag     bool
+	modtime  time.Time
+	requests map[string]int
+}
+
+func newCacheServer(t *testing.T, etag bool) *cacheServer {
+	data, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := &cacheServer{
+		data:     data,
+		etag:     etag,
+		modtime:  time.Date(2017, 10, 3, 0, 0, 0, 0, time.UTC),
+		requests: make(map[string]int),
+	}
+	cs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		cs.requests[r.Method]++
+		if cs.etag {
+			w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(cs.data)))
+		}
+		http.ServeContent(w, r, "db.gz", cs.modtime, bytes.NewReader(cs.data))
+	}))
+	return cs
+}
+
+// update replaces the database served by a new version of the same
+// size, with a different gzip header modification time.
+func (cs *cacheServer) update() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	data := make([]byte, len(cs.data))
+	copy(data, cs.data)
+	data[4]++ // MTIME field of the gzip header.
+	cs.data = data
+	cs.modtime = cs.modtime.Add(24 * time.Hour)
+}
+
+func (cs *cacheServer) count(method string) int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.requests[method]
+}
+
+func testConditionalUpdate(t *testing.T, etag bool) {
+	cs := newCacheServer(t, etag)
+	defer cs.Close()
+	db, dir := newRollbackDB(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	for _, want := range []struct{ Head, Get int }{
+		{0, 1}, // First download, no local file yet.
+		{0, 2}, // Conditional request, not modified.
+		{0, 3},
+	} {
+		if err := db.runUpdate(&HTTPSource{URL: cs.URL}); err != nil {
+			t.Fatal(err)
+		}
+		if head, get := cs.count("HEAD"), cs.count("GET"); head != want.Head || get != want.Get {
+			t.Fatalf("Unexpected requests: want %d HEAD %d GET, have %d HEAD %d GET",
+				want.Head, want.Get, head, get)
+		}
+	}
+	if _, err := os.Stat(db.backupFile(1)); err == nil {
+		t.Fatal("Unexpected database file was replaced")
+	}
+	// Same size, different contents.
+	cs.update()
+	if err := db.runUpdate(&HTTPSource{URL: cs.URL}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(db.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, cs.data) {
+		t.Fatal("Database file was not updated")
+	}
+	if v := readVersion(db.file, &HTTPSource{URL: cs.URL}); v == nil {
+		t.Fatal("Missing database version")
+	} else if etag && v.ETag == "" {
+		t.Fatal("Missing ETag")
+	} else if !v.LastModified.Equal(cs.modtime) {
+		t.Fatalf("Unexpected modification time: want %s, have %s", cs.modtime, v.LastModified)
+	}
+}
+
+func TestConditionalUpdateETag(t *testing.T) {
+	testConditionalUpdate(t, true)
+}
+
+func TestConditionalUpdateLastModified(t *testing.T) {
+	testConditionalUpdate(t, false)
+}
+
+func TestReadVersionOtherSource(t *testing.T) {
+	db, dir := newRollbackDB(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	if err := ioutil.WriteFile(db.file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := &HTTPSource{URL: "http://a/db.gz"}
+	b := &HTTPSource{URL: "http://b/db.gz"}
+	if err := writeVersion(db.file, a, &Version{ETag: `"1"`}); err != nil {
+		t.Fatal(err)
+	}
+	if v := readVersion(db.file, a); v == nil || v.ETag != `"1"` {
+		t.Fatalf("Unexpected version: %+v", v)
+	}
+	if readVersion(db.file, b) != nil {
+		t.Fatal("Unexpected version for another source")
+	}
+	os.Remove(db.file)
+	if readVersion(db.file, a) != nil {
+		t.Fatal("Unexpected version for missing file")
+	}
+}